@@ -0,0 +1,271 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// 请求体格式转换
+const (
+	BodyConvertFormToJSON = "form_to_json" // 转换步骤之前把 x-www-form-urlencoded 表单转换为 JSON 对象
+	BodyConvertJSONToForm = "json_to_form" // 转换步骤之后把 JSON 对象转换为 x-www-form-urlencoded 表单
+)
+
+// BodyTransformConfig JSON 请求体或响应体转换
+type BodyTransformConfig struct {
+	ContentTypes []string            `yaml:"content_types,omitempty" json:"content_types,omitempty"` // 转换的 Content-Type（前缀匹配），默认 application/json 和 +json 结尾的类型，form_to_json 时默认 application/x-www-form-urlencoded
+	StatusCodes  []int               `yaml:"status_codes,omitempty" json:"status_codes,omitempty"`   // 转换的响应状态码，默认 2xx（只用于响应体）
+	Convert      string              `yaml:"convert,omitempty" json:"convert,omitempty"`             // 格式转换：form_to_json、json_to_form（只用于请求体）
+	Steps        []BodyTransformStep `yaml:"steps,omitempty" json:"steps,omitempty"`                 // 按顺序执行的转换步骤
+}
+
+// BodyTransformStep JSON 转换步骤，每个步骤只能配置一种操作
+// 字段路径用 . 分隔，数字表示数组下标，# 表示数组的每个元素，如 items.#.price
+type BodyTransformStep struct {
+	Pick       []string             `yaml:"pick,omitempty" json:"pick,omitempty"`               // 只保留的字段
+	Omit       []string             `yaml:"omit,omitempty" json:"omit,omitempty"`               // 删除的字段
+	Rename     map[string]string    `yaml:"rename,omitempty" json:"rename,omitempty"`           // 重命名字段：旧路径 -> 新路径
+	MergePatch interface{}          `yaml:"merge_patch,omitempty" json:"merge_patch,omitempty"` // JSON Merge Patch（RFC 7386）
+	JSONPatch  []JSONPatchOperation `yaml:"json_patch,omitempty" json:"json_patch,omitempty"`   // JSON Patch（RFC 6902）
+	Map        map[string]string    `yaml:"map,omitempty" json:"map,omitempty"`                 // 按 gjson 路径取值组成新的 JSON：新字段路径 -> gjson 路径
+	Template   string               `yaml:"template,omitempty" json:"template,omitempty"`       // Go 模板，输出新的 JSON
+	Wrap       string               `yaml:"wrap,omitempty" json:"wrap,omitempty"`               // 把整个 JSON 包装为指定字段的值，如 data 得到 {"data": ...}
+
+	mergePatch interface{}
+	template   *template.Template
+}
+
+// JSONPatchOperation JSON Patch 操作
+type JSONPatchOperation struct {
+	Op    string      `yaml:"op" json:"op"`                           // add、remove、replace、move、copy、test
+	Path  string      `yaml:"path" json:"path"`                       // JSON Pointer，如 /items/0/price，/items/- 表示追加到数组末尾
+	From  string      `yaml:"from,omitempty" json:"from,omitempty"`   // move、copy 的来源
+	Value interface{} `yaml:"value,omitempty" json:"value,omitempty"` // add、replace、test 的值
+
+	value interface{}
+}
+
+// bodyTemplateFuncs 转换模板可以使用的函数
+var bodyTemplateFuncs = template.FuncMap{
+	// json 把值编码为 JSON，如 {{ json .body.user }}
+	"json": func(v interface{}) (string, error) {
+		var b bytes.Buffer
+		encoder := json.NewEncoder(&b)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(v); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(b.String(), "\n"), nil
+	},
+}
+
+// Matches 判断 Content-Type 和状态码是否需要转换，statusCode 为 0 时不检查状态码（请求体）
+func (t *BodyTransformConfig) Matches(contentType string, statusCode int) bool {
+	if statusCode != 0 {
+		if len(t.StatusCodes) == 0 {
+			if statusCode < 200 || statusCode > 299 {
+				return false
+			}
+		} else if !slices.Contains(t.StatusCodes, statusCode) {
+			return false
+		}
+	}
+
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	if len(t.ContentTypes) == 0 {
+		if t.Convert == BodyConvertFormToJSON {
+			return mediaType == "application/x-www-form-urlencoded"
+		}
+		return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	}
+	for _, prefix := range t.ContentTypes {
+		if strings.HasPrefix(mediaType, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// compile 校验并编译转换步骤
+func (t *BodyTransformConfig) compile(response bool) error {
+	switch t.Convert {
+	case "":
+		if len(t.Steps) == 0 {
+			return fmt.Errorf("没有配置转换步骤")
+		}
+	case BodyConvertFormToJSON, BodyConvertJSONToForm:
+		if response {
+			return fmt.Errorf("响应体不支持 convert")
+		}
+	default:
+		return fmt.Errorf("未知的 convert %q（支持 %s、%s）", t.Convert, BodyConvertFormToJSON, BodyConvertJSONToForm)
+	}
+	if !response && len(t.StatusCodes) > 0 {
+		return fmt.Errorf("请求体不支持 status_codes")
+	}
+	for i := range t.Steps {
+		if err := t.Steps[i].compile(); err != nil {
+			return fmt.Errorf("第 %d 步: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// compile 校验转换步骤，编译模板，把 YAML 中的值转换为 JSON 值
+func (s *BodyTransformStep) compile() error {
+	ops := 0
+	for _, set := range []bool{len(s.Pick) > 0, len(s.Omit) > 0, len(s.Rename) > 0, s.MergePatch != nil, len(s.JSONPatch) > 0, len(s.Map) > 0, s.Template != "", s.Wrap != ""} {
+		if set {
+			ops++
+		}
+	}
+	if ops != 1 {
+		return fmt.Errorf("pick、omit、rename、merge_patch、json_patch、map、template、wrap 需要且只能配置一个")
+	}
+
+	for from, to := range s.Rename {
+		if err := validateRenamePath(from, to); err != nil {
+			return err
+		}
+	}
+	for to := range s.Map {
+		if slices.Contains(SplitJSONPath(to), "#") {
+			return fmt.Errorf("map 的字段路径 %q 不能包含 #", to)
+		}
+	}
+	if s.MergePatch != nil {
+		value, err := toJSONValue(s.MergePatch)
+		if err != nil {
+			return fmt.Errorf("merge_patch 无效: %w", err)
+		}
+		s.mergePatch = value
+	}
+	for i := range s.JSONPatch {
+		if err := s.JSONPatch[i].compile(); err != nil {
+			return fmt.Errorf("json_patch 第 %d 个操作: %w", i+1, err)
+		}
+	}
+	if s.Template != "" {
+		tmpl, err := parseBodyTemplate(s.Template)
+		if err != nil {
+			return err
+		}
+		s.template = tmpl
+	}
+	return nil
+}
+
+// compile 校验 JSON Patch 操作
+func (o *JSONPatchOperation) compile() error {
+	switch o.Op {
+	case "add", "replace", "test":
+		value, err := toJSONValue(o.Value)
+		if err != nil {
+			return fmt.Errorf("value 无效: %w", err)
+		}
+		o.value = value
+	case "move", "copy":
+		if o.From != "" && !strings.HasPrefix(o.From, "/") {
+			return fmt.Errorf("from %q 不是有效的 JSON Pointer", o.From)
+		}
+	case "remove":
+	default:
+		return fmt.Errorf("未知的操作 %q（支持 add、remove、replace、move、copy、test）", o.Op)
+	}
+	if o.Path != "" && !strings.HasPrefix(o.Path, "/") {
+		return fmt.Errorf("path %q 不是有效的 JSON Pointer", o.Path)
+	}
+	return nil
+}
+
+// validateRenamePath 校验重命名的路径：# 只能出现在两个路径相同的前缀中
+func validateRenamePath(from, to string) error {
+	fromParts, toParts := SplitJSONPath(from), SplitJSONPath(to)
+	i := 0
+	for i < len(fromParts)-1 && i < len(toParts)-1 && fromParts[i] == toParts[i] {
+		i++
+	}
+	for _, part := range append(fromParts[i:], toParts[i:]...) {
+		if part == "#" {
+			return fmt.Errorf("重命名 %s -> %s 无效：# 只能出现在两个路径相同的前缀中", from, to)
+		}
+	}
+	return nil
+}
+
+// parseBodyTemplate 解析转换模板
+func parseBodyTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("body").Funcs(bodyTemplateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("解析模板失败: %w", err)
+	}
+	return tmpl, nil
+}
+
+// toJSONValue 把 YAML 解析出的值转换为 JSON 值（对象为 map[string]interface{}，数字为 json.Number）
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// MergePatchValue 返回 merge_patch 的 JSON 值
+func (s *BodyTransformStep) MergePatchValue() interface{} {
+	if s.mergePatch == nil {
+		// 没有经过 LoadConfig/SaveConfig 的配置，临时转换
+		value, _ := toJSONValue(s.MergePatch)
+		return value
+	}
+	return s.mergePatch
+}
+
+// CompiledTemplate 返回编译后的模板
+func (s *BodyTransformStep) CompiledTemplate() (*template.Template, error) {
+	if s.template == nil {
+		// 没有经过 LoadConfig/SaveConfig 的配置，临时解析
+		return parseBodyTemplate(s.Template)
+	}
+	return s.template, nil
+}
+
+// JSONValue 返回 value 的 JSON 值
+func (o *JSONPatchOperation) JSONValue() interface{} {
+	if o.value == nil {
+		// 没有经过 LoadConfig/SaveConfig 的配置，临时转换
+		value, _ := toJSONValue(o.Value)
+		return value
+	}
+	return o.value
+}
+
+// SplitJSONPath 拆分点分隔的字段路径，\. 表示字段名中的点
+func SplitJSONPath(path string) []string {
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path) && path[i+1] == '.':
+			part.WriteByte('.')
+			i++
+		case path[i] == '.':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(path[i])
+		}
+	}
+	return append(parts, part.String())
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// 聚合规则子请求失败时的处理
+const (
+	CompositeOnErrorFail    = "fail"    // 必需的子请求失败时返回 502
+	CompositeOnErrorPartial = "partial" // 返回已有的结果，失败的子请求结果为 null
+)
+
+// 子请求结果在合并后 JSON 中的特殊位置
+const (
+	CompositeAsRoot = "." // 把对象的字段合并到顶层
+	CompositeAsNone = "-" // 不输出，只供其他子请求引用
+)
+
+// CompositeConfig 聚合配置：向多个上游发起子请求，把结果合并为一个 JSON 对象返回
+// 没有依赖关系的子请求并行执行，引用了其他子请求结果的子请求在依赖完成后执行
+type CompositeConfig struct {
+	Calls   []CompositeCall `yaml:"calls" json:"calls"`                           // 子请求
+	OnError string          `yaml:"on_error,omitempty" json:"on_error,omitempty"` // 必需的子请求失败时的处理：fail（默认，返回 502）、partial（返回已有的结果）
+}
+
+// CompositeCall 聚合规则的子请求
+type CompositeCall struct {
+	Name      string              `yaml:"name" json:"name"`                                 // 名称，其他子请求通过 {call.名称.gjson路径} 引用响应体中的值
+	Target    string              `yaml:"target" json:"target"`                             // 上游地址，如 http://user-service:8080
+	Method    string              `yaml:"method,omitempty" json:"method,omitempty"`         // 请求方法，默认 GET
+	Path      string              `yaml:"path" json:"path"`                                 // 路径和查询参数，支持模板，变量的值会进行 URL 转义
+	Headers   map[string]string   `yaml:"headers,omitempty" json:"headers,omitempty"`       // 请求头，支持模板，渲染结果为空时不发送
+	Body      string              `yaml:"body,omitempty" json:"body,omitempty"`             // JSON 请求体，支持模板，变量按 JSON 值代入，只能作为完整的值使用
+	Timeout   int                 `yaml:"timeout,omitempty" json:"timeout,omitempty"`       // 超时（毫秒），默认使用规则的 timeout
+	DependsOn []string            `yaml:"depends_on,omitempty" json:"depends_on,omitempty"` // 依赖的子请求，模板中引用的子请求会自动加入
+	Optional  bool                `yaml:"optional,omitempty" json:"optional,omitempty"`     // 可选：失败时结果为 null，不影响整体响应
+	As        string              `yaml:"as,omitempty" json:"as,omitempty"`                 // 结果在合并后 JSON 中的字段路径，默认为名称；. 表示合并到顶层，- 表示不输出
+	Steps     []BodyTransformStep `yaml:"steps,omitempty" json:"steps,omitempty"`           // 对子请求的响应体执行的转换步骤
+
+	path    *Template
+	headers map[string]*Template
+	body    *Template
+	deps    []string
+}
+
+// compile 校验子请求，编译模板，计算依赖关系并检查循环依赖
+func (c *CompositeConfig) compile() error {
+	switch c.OnError {
+	case "", CompositeOnErrorFail, CompositeOnErrorPartial:
+	default:
+		return fmt.Errorf("未知的 on_error %q（支持 %s、%s）", c.OnError, CompositeOnErrorFail, CompositeOnErrorPartial)
+	}
+	if len(c.Calls) == 0 {
+		return fmt.Errorf("没有配置子请求")
+	}
+
+	names := make(map[string]bool, len(c.Calls))
+	for i := range c.Calls {
+		name := c.Calls[i].Name
+		if name == "" || strings.ContainsAny(name, ".{}") {
+			return fmt.Errorf("第 %d 个子请求的名称 %q 无效（不能为空，不能包含 . 和花括号）", i+1, name)
+		}
+		if names[name] {
+			return fmt.Errorf("子请求名称 %q 重复", name)
+		}
+		names[name] = true
+	}
+
+	for i := range c.Calls {
+		call := &c.Calls[i]
+		if err := call.compile(names); err != nil {
+			return fmt.Errorf("子请求 %q: %w", call.Name, err)
+		}
+	}
+	return c.checkCycle()
+}
+
+// compile 校验并编译子请求，names 为所有子请求的名称
+func (c *CompositeCall) compile(names map[string]bool) error {
+	target, err := url.Parse(c.Target)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("target %q 不是有效的 http 或 https 地址", c.Target)
+	}
+	if c.Method != "" && strings.ToUpper(c.Method) != c.Method {
+		return fmt.Errorf("method %q 需要大写", c.Method)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout 不能小于 0")
+	}
+
+	var templates []*Template
+	if c.path, err = ParseTemplate(c.Path); err != nil {
+		return err
+	}
+	templates = append(templates, c.path)
+	c.headers = make(map[string]*Template, len(c.Headers))
+	for key, value := range c.Headers {
+		if c.headers[key], err = ParseTemplate(value); err != nil {
+			return err
+		}
+		templates = append(templates, c.headers[key])
+	}
+	if c.Body != "" {
+		if c.body, err = ParseTemplate(c.Body); err != nil {
+			return err
+		}
+		// 变量只能作为完整的 JSON 值，客户端的值不能改变请求体的结构；放在字符串中时代入的对象会使 JSON 无效
+		if !json.Valid([]byte(c.body.Render(func(source, name string) string { return `{"value":null}` }))) {
+			return fmt.Errorf(`body 需要是 JSON，变量只能作为完整的值使用，如 {{"id": {call.user.id}}}`)
+		}
+		templates = append(templates, c.body)
+	}
+
+	// 依赖：depends_on 加上模板中引用的子请求
+	deps := slices.Clone(c.DependsOn)
+	for _, t := range templates {
+		for _, name := range t.Names(TemplateSourceCall) {
+			dep, _, _ := strings.Cut(name, ".")
+			deps = append(deps, dep)
+		}
+	}
+	slices.Sort(deps)
+	c.deps = slices.Compact(deps)
+	for _, dep := range c.deps {
+		if !names[dep] {
+			return fmt.Errorf("依赖的子请求 %q 不存在", dep)
+		}
+		if dep == c.Name {
+			return fmt.Errorf("不能依赖自己")
+		}
+	}
+
+	for i := range c.Steps {
+		if err := c.Steps[i].compile(); err != nil {
+			return fmt.Errorf("第 %d 步: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// checkCycle 检查子请求之间的循环依赖
+func (c *CompositeConfig) checkCycle() error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	calls := make(map[string]*CompositeCall, len(c.Calls))
+	for i := range c.Calls {
+		calls[c.Calls[i].Name] = &c.Calls[i]
+	}
+	state := make(map[string]int, len(c.Calls))
+	var visit func(name string, chain []string) error
+	visit = func(name string, chain []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("子请求循环依赖: %s", strings.Join(append(chain, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range calls[name].deps {
+			if err := visit(dep, append(chain, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for i := range c.Calls {
+		if err := visit(c.Calls[i].Name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FailFast 必需的子请求失败时是否返回 502
+func (c *CompositeConfig) FailFast() bool {
+	return c.OnError != CompositeOnErrorPartial
+}
+
+// RequestMethod 返回子请求的方法，默认 GET
+func (c *CompositeCall) RequestMethod() string {
+	if c.Method == "" {
+		return http.MethodGet
+	}
+	return c.Method
+}
+
+// ResultPath 返回结果在合并后 JSON 中的字段路径
+func (c *CompositeCall) ResultPath() string {
+	if c.As == "" {
+		return c.Name
+	}
+	return c.As
+}
+
+// Dependencies 返回子请求依赖的其他子请求
+func (c *CompositeCall) Dependencies() []string {
+	if c.deps == nil && c.path == nil {
+		// 没有经过 LoadConfig/SaveConfig 的配置，只使用 depends_on
+		return c.DependsOn
+	}
+	return c.deps
+}
+
+// RenderPath 渲染路径模板，变量的值按所在位置进行 URL 转义
+func (c *CompositeCall) RenderPath(lookup func(source, name string) string) string {
+	if c.path == nil {
+		// 没有经过 LoadConfig/SaveConfig 的配置，按原文使用
+		return c.Path
+	}
+	return c.path.RenderURI(lookup)
+}
+
+// RenderHeader 渲染请求头模板
+func (c *CompositeCall) RenderHeader(key string, lookup func(source, name string) string) string {
+	t, ok := c.headers[key]
+	if !ok {
+		// 没有经过 LoadConfig/SaveConfig 的配置，按原文使用
+		return c.Headers[key]
+	}
+	return t.Render(lookup)
+}
+
+// RenderBody 渲染请求体模板，lookup 需要返回 JSON 编码后的值
+func (c *CompositeCall) RenderBody(lookup func(source, name string) string) string {
+	if c.body == nil {
+		// 没有经过 LoadConfig/SaveConfig 的配置，按原文使用
+		return c.Body
+	}
+	return c.body.Render(lookup)
+}
+
+// compositeTargets 返回聚合规则所有子请求的上游地址（去重）
+func (c *CompositeConfig) compositeTargets() []UpstreamTarget {
+	var targets []UpstreamTarget
+	seen := make(map[string]bool)
+	for _, call := range c.Calls {
+		if !seen[call.Target] {
+			seen[call.Target] = true
+			targets = append(targets, UpstreamTarget{URL: call.Target, Weight: 1})
+		}
+	}
+	return targets
+}
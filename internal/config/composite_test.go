@@ -0,0 +1,69 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestCompositeRenderPath 子请求路径中的变量按所在位置转义，客户端的值不能引入额外的路径段、查询参数或片段
+func TestCompositeRenderPath(t *testing.T) {
+	values := map[string]string{
+		"path.id":   "7",
+		"path.rest": "a/b c",
+		"query.sub": "../../admin?x#y",
+		"query.q":   "a&admin=1",
+	}
+	lookup := func(source, name string) string {
+		return values[source+"."+name]
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/users/{path.id}", "/users/7"},
+		{"/users/{query.sub}", "/users/..%2F..%2Fadmin%3Fx%23y"},
+		{"/files/{path.rest}", "/files/a/b%20c"},
+		{"/users/{path.id}?q={query.q}&x=1", "/users/7?q=a%26admin%3D1&x=1"},
+		{"/search?path={path.rest}", "/search?path=a%2Fb+c"},
+	}
+	for _, tt := range tests {
+		call := &CompositeCall{Name: "orders", Target: "http://127.0.0.1:8080", Path: tt.path}
+		if err := call.compile(map[string]bool{"orders": true}); err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if got := call.RenderPath(lookup); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestCompositeBodyTemplate 请求体中的变量只能作为完整的 JSON 值使用
+func TestCompositeBodyTemplate(t *testing.T) {
+	tests := []struct {
+		body string
+		ok   bool
+	}{
+		{`{{"id": {call.user.id}, "name": {query.name}}}`, true},
+		{`{{"ids": [{call.user.id}, {query.id}], "user": {call.user}}}`, true},
+		{`{call.user}`, true},
+		{`{{"name": "{query.name}"}}`, false},
+		{`{{"name": "prefix-{query.name}"}}`, false},
+		{`{{{query.key}: 1}}`, false},
+		{`{{"a": {query.a}{query.b}}}`, false},
+		{`not json`, false},
+	}
+	names := map[string]bool{"orders": true, "user": true}
+	for _, tt := range tests {
+		call := &CompositeCall{Name: "orders", Target: "http://127.0.0.1:8080", Path: "/", Body: tt.body}
+		err := call.compile(names)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok = %v", tt.body, err, tt.ok)
+			continue
+		}
+		if err == nil && strings.Contains(tt.body, "call.user") && !slices.Contains(call.Dependencies(), "user") {
+			t.Errorf("%s: dependencies %v, want user", tt.body, call.Dependencies())
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 值匹配运算符
+const (
+	OpEq        = "eq"         // 等于（默认）
+	OpExists    = "exists"     // 存在（值可以为空）
+	OpNotExists = "not_exists" // 不存在
+	OpRegex     = "regex"      // 正则表达式（不会自动添加 ^、$）
+	OpPrefix    = "prefix"     // 前缀
+	OpSuffix    = "suffix"     // 后缀
+	OpContains  = "contains"   // 包含子串
+	OpIn        = "in"         // 等于 values 中的任意一个
+	OpGt        = "gt"         // 数值大于
+	OpGte       = "gte"        // 数值大于等于
+	OpLt        = "lt"         // 数值小于
+	OpLte       = "lte"        // 数值小于等于
+)
+
+// ValueCondition Header、Query、Body 的值匹配条件
+// 配置中可以直接写字符串，表示等于该值；也可以写成对象指定运算符
+type ValueCondition struct {
+	Op         string   `yaml:"op,omitempty" json:"op,omitempty"`                   // 运算符，默认 eq
+	Value      string   `yaml:"value,omitempty" json:"value,omitempty"`             // 比较的值
+	Values     []string `yaml:"values,omitempty" json:"values,omitempty"`           // in 运算符的候选值
+	IgnoreCase bool     `yaml:"ignore_case,omitempty" json:"ignore_case,omitempty"` // 忽略大小写（eq、prefix、suffix、contains、in、regex）
+	Negate     bool     `yaml:"negate,omitempty" json:"negate,omitempty"`           // 取反，值不存在时也算匹配
+
+	re *regexp.Regexp
+}
+
+// valueCondition 用于解析对象形式的条件，避免递归调用自定义的解析方法
+type valueCondition ValueCondition
+
+// isShorthand 是否可以写成字符串形式
+func (v *ValueCondition) isShorthand() bool {
+	return (v.Op == "" || v.Op == OpEq) && !v.IgnoreCase && !v.Negate && len(v.Values) == 0
+}
+
+// UnmarshalYAML 支持字符串和对象两种写法
+func (v *ValueCondition) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*v = ValueCondition{Value: node.Value}
+		return nil
+	}
+	var cond valueCondition
+	if err := node.Decode(&cond); err != nil {
+		return err
+	}
+	*v = ValueCondition(cond)
+	return nil
+}
+
+// MarshalYAML 等于条件写成字符串，保持配置文件简洁
+func (v ValueCondition) MarshalYAML() (interface{}, error) {
+	if v.isShorthand() {
+		return v.Value, nil
+	}
+	return valueCondition(v), nil
+}
+
+// UnmarshalJSON 支持字符串和对象两种写法，对象中的 value 可以是数字或布尔值
+func (v *ValueCondition) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = ValueCondition{Value: s}
+		return nil
+	}
+
+	var cond struct {
+		valueCondition
+		Value json.RawMessage `json:"value,omitempty"`
+	}
+	if err := json.Unmarshal(data, &cond); err != nil {
+		return err
+	}
+	*v = ValueCondition(cond.valueCondition)
+	if len(cond.Value) > 0 {
+		if err := json.Unmarshal(cond.Value, &v.Value); err != nil {
+			v.Value = string(cond.Value)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON 等于条件写成字符串，兼容只支持字符串的旧版管理界面
+func (v ValueCondition) MarshalJSON() ([]byte, error) {
+	if v.isShorthand() {
+		return json.Marshal(v.Value)
+	}
+	return json.Marshal(valueCondition(v))
+}
+
+// compile 校验并编译条件
+func (v *ValueCondition) compile() error {
+	switch v.Op {
+	case "", OpEq, OpExists, OpNotExists, OpPrefix, OpSuffix, OpContains:
+	case OpIn:
+		if len(v.Values) == 0 {
+			return fmt.Errorf("in 运算符需要配置 values")
+		}
+	case OpRegex:
+		expr := v.Value
+		if v.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("编译正则表达式 %q 失败: %w", v.Value, err)
+		}
+		v.re = re
+	case OpGt, OpGte, OpLt, OpLte:
+		if _, err := strconv.ParseFloat(strings.TrimSpace(v.Value), 64); err != nil {
+			return fmt.Errorf("%s 运算符的值 %q 不是数字", v.Op, v.Value)
+		}
+	default:
+		return fmt.Errorf("未知的运算符 %q（支持 eq、exists、not_exists、regex、prefix、suffix、contains、in、gt、gte、lt、lte）", v.Op)
+	}
+	return nil
+}
+
+// Match 判断值是否满足条件，exists 表示请求中是否存在该值
+func (v *ValueCondition) Match(value string, exists bool) bool {
+	return v.match(value, exists) != v.Negate
+}
+
+// MatchOrEmpty 匹配 Header 和 Query 参数，等于空字符串的条件也匹配不存在的值
+// 兼容旧版配置：旧版把不存在的 Header 和 Query 参数当作空字符串比较，headers: {X-Foo: ""} 也匹配没有 X-Foo 的请求
+func (v *ValueCondition) MatchOrEmpty(value string, exists bool) bool {
+	if !exists && (v.Op == "" || v.Op == OpEq) && v.Value == "" {
+		return !v.Negate
+	}
+	return v.Match(value, exists)
+}
+
+// MatchNumber 匹配数字类型的值，eq、in 按数值比较（如 1 与 1.0 相等），其余运算符与 Match 相同
+func (v *ValueCondition) MatchNumber(value string) bool {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return v.Match(value, true)
+	}
+	equal := func(candidate string) bool {
+		expected, err := strconv.ParseFloat(strings.TrimSpace(candidate), 64)
+		return err == nil && number == expected
+	}
+
+	switch v.Op {
+	case "", OpEq:
+		return equal(v.Value) != v.Negate
+	case OpIn:
+		for _, candidate := range v.Values {
+			if equal(candidate) {
+				return !v.Negate
+			}
+		}
+		return v.Negate
+	default:
+		return v.Match(value, true)
+	}
+}
+
+// match 不考虑取反的匹配
+func (v *ValueCondition) match(value string, exists bool) bool {
+	switch v.Op {
+	case OpExists:
+		return exists
+	case OpNotExists:
+		return !exists
+	}
+	if !exists {
+		return false
+	}
+
+	equal := func(a, b string) bool {
+		if v.IgnoreCase {
+			return strings.EqualFold(a, b)
+		}
+		return a == b
+	}
+	lower := func(s string) string {
+		if v.IgnoreCase {
+			return strings.ToLower(s)
+		}
+		return s
+	}
+
+	switch v.Op {
+	case OpRegex:
+		re := v.re
+		if re == nil {
+			// 没有经过 LoadConfig/SaveConfig 的配置，临时编译
+			expr := v.Value
+			if v.IgnoreCase {
+				expr = "(?i)" + expr
+			}
+			var err error
+			if re, err = regexp.Compile(expr); err != nil {
+				return false
+			}
+		}
+		return re.MatchString(value)
+	case OpPrefix:
+		return strings.HasPrefix(lower(value), lower(v.Value))
+	case OpSuffix:
+		return strings.HasSuffix(lower(value), lower(v.Value))
+	case OpContains:
+		return strings.Contains(lower(value), lower(v.Value))
+	case OpIn:
+		for _, candidate := range v.Values {
+			if equal(value, candidate) {
+				return true
+			}
+		}
+		return false
+	case OpGt, OpGte, OpLt, OpLte:
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return false
+		}
+		expected, err := strconv.ParseFloat(strings.TrimSpace(v.Value), 64)
+		if err != nil {
+			return false
+		}
+		switch v.Op {
+		case OpGt:
+			return number > expected
+		case OpGte:
+			return number >= expected
+		case OpLt:
+			return number < expected
+		default:
+			return number <= expected
+		}
+	default:
+		return equal(value, v.Value)
+	}
+}
+
+// compileConditions 校验并编译一组值匹配条件
+func compileConditions(kind string, conditions map[string]*ValueCondition) error {
+	for key, cond := range conditions {
+		if cond == nil {
+			// 配置中写了 key: 但没有值，视为等于空字符串
+			conditions[key] = &ValueCondition{}
+			continue
+		}
+		if err := cond.compile(); err != nil {
+			return fmt.Errorf("%s %s: %w", kind, key, err)
+		}
+	}
+	return nil
+}
+
+// compile 校验并编译 GraphQL 匹配条件
+func (g *GraphQLMatch) compile() error {
+	switch g.OperationType {
+	case "", "query", "mutation", "subscription":
+	default:
+		return fmt.Errorf("未知的 GraphQL 操作类型 %q（支持 query、mutation、subscription）", g.OperationType)
+	}
+	if g.OperationName != nil {
+		if err := g.OperationName.compile(); err != nil {
+			return fmt.Errorf("GraphQL 操作名: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestValueConditionMatch 各运算符的匹配结果，exists 表示请求中是否存在该值
+func TestValueConditionMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   ValueCondition
+		value  string
+		exists bool
+		want   bool
+	}{
+		{"等于", ValueCondition{Value: "a"}, "a", true, true},
+		{"不等于", ValueCondition{Value: "a"}, "b", true, false},
+		{"不存在", ValueCondition{Value: "a"}, "", false, false},
+		{"空值不匹配不存在", ValueCondition{Value: ""}, "", false, false},
+		{"空值匹配空值", ValueCondition{Op: OpEq}, "", true, true},
+		{"空值不匹配非空值", ValueCondition{Value: ""}, "a", true, false},
+		{"空值取反时不存在也匹配", ValueCondition{Value: "", Negate: true}, "", false, true},
+		{"忽略大小写", ValueCondition{Value: "ABC", IgnoreCase: true}, "abc", true, true},
+		{"存在", ValueCondition{Op: OpExists}, "", true, true},
+		{"存在但缺失", ValueCondition{Op: OpExists}, "", false, false},
+		{"不存在运算符", ValueCondition{Op: OpNotExists}, "", false, true},
+		{"不存在运算符但存在", ValueCondition{Op: OpNotExists}, "a", true, false},
+		{"正则", ValueCondition{Op: OpRegex, Value: `^v\d+$`}, "v12", true, true},
+		{"正则不自动锚定", ValueCondition{Op: OpRegex, Value: `\d+`}, "v12x", true, true},
+		{"正则忽略大小写", ValueCondition{Op: OpRegex, Value: `^beta`, IgnoreCase: true}, "BETA-1", true, true},
+		{"前缀", ValueCondition{Op: OpPrefix, Value: "Bearer "}, "Bearer x", true, true},
+		{"前缀缺失", ValueCondition{Op: OpPrefix, Value: ""}, "", false, false},
+		{"后缀", ValueCondition{Op: OpSuffix, Value: ".json", IgnoreCase: true}, "A.JSON", true, true},
+		{"包含", ValueCondition{Op: OpContains, Value: "mobile"}, "ios-mobile-app", true, true},
+		{"候选值", ValueCondition{Op: OpIn, Values: []string{"a", "b"}}, "b", true, true},
+		{"不在候选值中", ValueCondition{Op: OpIn, Values: []string{"a", "b"}}, "c", true, false},
+		{"大于", ValueCondition{Op: OpGt, Value: "10"}, "10.5", true, true},
+		{"大于等于", ValueCondition{Op: OpGte, Value: "10"}, "10", true, true},
+		{"小于", ValueCondition{Op: OpLt, Value: "10"}, "10", true, false},
+		{"小于等于", ValueCondition{Op: OpLte, Value: " 10 "}, "9", true, true},
+		{"非数字", ValueCondition{Op: OpGt, Value: "10"}, "abc", true, false},
+		{"取反", ValueCondition{Op: OpPrefix, Value: "beta", Negate: true}, "prod", true, true},
+		{"取反时不存在也匹配", ValueCondition{Value: "a", Negate: true}, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond := tt.cond
+			if err := cond.compile(); err != nil {
+				t.Fatal(err)
+			}
+			if got := cond.Match(tt.value, tt.exists); got != tt.want {
+				t.Errorf("Match(%q, %v) = %v, want %v", tt.value, tt.exists, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestValueConditionMatchOrEmpty Header 和 Query 参数兼容旧版配置，等于空字符串的条件也匹配不存在的值
+func TestValueConditionMatchOrEmpty(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   ValueCondition
+		value  string
+		exists bool
+		want   bool
+	}{
+		{"空值匹配不存在", ValueCondition{Value: ""}, "", false, true},
+		{"eq 空值匹配不存在", ValueCondition{Op: OpEq}, "", false, true},
+		{"空值匹配空值", ValueCondition{Value: ""}, "", true, true},
+		{"空值不匹配非空值", ValueCondition{Value: ""}, "a", true, false},
+		{"空值取反", ValueCondition{Value: "", Negate: true}, "", false, false},
+		{"非空值不匹配不存在", ValueCondition{Value: "a"}, "", false, false},
+		{"其他运算符不受影响", ValueCondition{Op: OpPrefix}, "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cond.MatchOrEmpty(tt.value, tt.exists); got != tt.want {
+				t.Errorf("MatchOrEmpty(%q, %v) = %v, want %v", tt.value, tt.exists, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestValueConditionMatchNumber 数字类型的值按数值比较
+func TestValueConditionMatchNumber(t *testing.T) {
+	tests := []struct {
+		cond  ValueCondition
+		value string
+		want  bool
+	}{
+		{ValueCondition{Value: "1"}, "1.0", true},
+		{ValueCondition{Value: "1"}, "2", false},
+		{ValueCondition{Value: "1", Negate: true}, "1.0", false},
+		{ValueCondition{Op: OpIn, Values: []string{"1", "2"}}, "2.0", true},
+		{ValueCondition{Op: OpIn, Values: []string{"1", "2"}, Negate: true}, "3", true},
+		{ValueCondition{Op: OpGt, Value: "1"}, "1e1", true},
+		{ValueCondition{Op: OpPrefix, Value: "1"}, "12", true},
+	}
+	for _, tt := range tests {
+		if got := tt.cond.MatchNumber(tt.value); got != tt.want {
+			t.Errorf("%+v MatchNumber(%q) = %v, want %v", tt.cond, tt.value, got, tt.want)
+		}
+	}
+}
+
+// TestValueConditionCompile 无效的运算符和值在加载时报错
+func TestValueConditionCompile(t *testing.T) {
+	tests := []struct {
+		cond ValueCondition
+		ok   bool
+	}{
+		{ValueCondition{Value: "a"}, true},
+		{ValueCondition{Op: OpIn, Values: []string{"a"}}, true},
+		{ValueCondition{Op: OpIn}, false},
+		{ValueCondition{Op: OpRegex, Value: "("}, false},
+		{ValueCondition{Op: OpGt, Value: "abc"}, false},
+		{ValueCondition{Op: "like", Value: "a"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.cond.compile(); (err == nil) != tt.ok {
+			t.Errorf("%+v: err = %v, want ok = %v", tt.cond, err, tt.ok)
+		}
+	}
+}
+
+// TestValueConditionEncoding 等于条件可以写成字符串，对象中的 value 可以是数字或布尔值
+func TestValueConditionEncoding(t *testing.T) {
+	var match MatchCondition
+	err := yaml.Unmarshal([]byte(`
+headers:
+  X-Env: beta
+  X-Empty:
+  X-Version: {op: gte, value: 2}
+`), &match)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := match.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if cond := match.Headers["X-Env"]; cond.Op != "" || cond.Value != "beta" {
+		t.Errorf("X-Env = %+v", cond)
+	}
+	if cond := match.Headers["X-Empty"]; cond == nil || !cond.MatchOrEmpty("", false) {
+		t.Errorf("X-Empty = %+v，期望匹配不存在的值", cond)
+	}
+	if cond := match.Headers["X-Version"]; cond.Op != OpGte || cond.Value != "2" {
+		t.Errorf("X-Version = %+v", cond)
+	}
+
+	out, err := json.Marshal(match.Headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]*ValueCondition
+	if err := json.Unmarshal(out, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["X-Env"].Value != "beta" || decoded["X-Version"].Op != OpGte {
+		t.Errorf("JSON 往返后得到 %s", out)
+	}
+
+	var cond ValueCondition
+	if err := json.Unmarshal([]byte(`{"op":"eq","value":true}`), &cond); err != nil {
+		t.Fatal(err)
+	}
+	if cond.Value != "true" {
+		t.Errorf("value = %q, want true", cond.Value)
+	}
+}
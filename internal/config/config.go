@@ -1,9 +1,11 @@
 package config
 
 import (
+	"crypto/tls"
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -11,8 +13,10 @@ import (
 )
 
 var (
-	globalConfig *Config
-	configMutex  sync.RWMutex
+	// globalConfig 当前配置（包括编译后的路由表），热加载时整体替换，每个请求读取时不需要加锁
+	globalConfig atomic.Pointer[Config]
+	configMutex  sync.Mutex
+	listeners    []func(cfg *Config)
 )
 
 // Config 应用配置
@@ -29,33 +33,208 @@ type AdminAuthConfig struct {
 	CookieValue string `yaml:"cookie_value" json:"cookie_value"` // Cookie 值
 }
 
+// Cookie 返回管理后台认证的 Cookie 键名和值，未配置时使用默认值
+func (a AdminAuthConfig) Cookie() (string, string) {
+	key, value := a.CookieKey, a.CookieValue
+	if key == "" {
+		key = "bff_admin_token"
+	}
+	if value == "" {
+		value = "change_me_in_production"
+	}
+	return key, value
+}
+
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Port int `yaml:"port" json:"port"`
+	Port      int              `yaml:"port" json:"port"`
+	Listeners []ListenerConfig `yaml:"listeners,omitempty" json:"listeners,omitempty"` // 额外的监听端口（如 HTTPS），修改后需要重启服务
+}
+
+// ListenerConfig 额外的监听端口配置
+type ListenerConfig struct {
+	Port         int                `yaml:"port" json:"port"`
+	TLS          *ListenerTLSConfig `yaml:"tls,omitempty" json:"tls,omitempty"`                     // 配置后以 HTTPS 监听
+	DisableHTTP2 bool               `yaml:"disable_http2,omitempty" json:"disable_http2,omitempty"` // HTTPS 监听默认通过 ALPN 支持 HTTP/2，设置后只使用 HTTP/1.1
+	H2C          bool               `yaml:"h2c,omitempty" json:"h2c,omitempty"`                     // HTTP 监听同时支持明文 HTTP/2（h2c），gRPC 客户端需要开启
+}
+
+// ListenerTLSConfig HTTPS 监听的证书配置，证书文件变化后自动重新加载
+type ListenerTLSConfig struct {
+	CertFile   string   `yaml:"cert_file,omitempty" json:"cert_file,omitempty"`     // 证书文件（PEM）
+	KeyFile    string   `yaml:"key_file,omitempty" json:"key_file,omitempty"`       // 私钥文件（PEM）
+	SelfSigned bool     `yaml:"self_signed,omitempty" json:"self_signed,omitempty"` // 未配置证书文件时自动生成自签名开发证书
+	Hosts      []string `yaml:"hosts,omitempty" json:"hosts,omitempty"`             // 自签名证书额外包含的域名或 IP（默认包含 localhost 和本机 IP）
 }
 
 // ProxyConfig 代理配置
 type ProxyConfig struct {
-	Rules []ProxyRule `yaml:"rules" json:"rules"`
+	Rules      []ProxyRule      `yaml:"rules" json:"rules"`
+	MatchMode  string           `yaml:"match_mode,omitempty" json:"match_mode,omitempty"` // 匹配模式：first（默认，第一个匹配的规则生效）、best（同一优先级中最具体的规则生效）
+	Forwarding ForwardingConfig `yaml:"forwarding,omitempty" json:"forwarding,omitempty"` // 转发请求头（X-Forwarded-For 等）和受信任的代理
+
+	routes *RouteTable // 编译后的路由表，配置加载时创建
 }
 
 // ProxyRule 代理规则
 type ProxyRule struct {
-	Name        string            `yaml:"name" json:"name"`
-	Match       MatchCondition    `yaml:"match" json:"match"`
-	Target      string            `yaml:"target" json:"target"`
-	Timeout     int               `yaml:"timeout" json:"timeout"`           // 超时时间（秒）
-	Headers     map[string]string `yaml:"headers" json:"headers"`          // 额外添加的请求头
-	RewritePath string            `yaml:"rewrite_path" json:"rewrite_path"` // 路径重写
+	Name         string             `yaml:"name" json:"name"`
+	Priority     int                `yaml:"priority,omitempty" json:"priority,omitempty"` // 优先级，数值大的规则先匹配，相同时按配置顺序
+	Match        MatchCondition     `yaml:"match" json:"match"`
+	Target       string             `yaml:"target" json:"target"`
+	Targets      []UpstreamTarget   `yaml:"targets,omitempty" json:"targets,omitempty"`                 // 多个上游目标（配置后忽略 Target）
+	LoadBalance  LoadBalanceConfig  `yaml:"load_balance,omitempty" json:"load_balance,omitempty"`       // 负载均衡策略
+	Timeout      int                `yaml:"timeout" json:"timeout"`                                     // 超时时间（秒）
+	Headers      map[string]string  `yaml:"headers" json:"headers"`                                     // 额外添加的请求头
+	PreserveHost bool               `yaml:"preserve_host,omitempty" json:"preserve_host,omitempty"`     // 转发时保留客户端请求的 Host，默认使用目标地址的主机名
+	RewritePath  string             `yaml:"rewrite_path" json:"rewrite_path"`                           // 路径重写（替换匹配的前缀；glob、regex 匹配方式下作为正则替换结果）
+	Rewrite      *RewriteConfig     `yaml:"rewrite,omitempty" json:"rewrite,omitempty"`                 // 路径和查询参数重写表达式（在 rewrite_path 之后处理）
+	HealthCheck  HealthCheckConfig  `yaml:"health_check,omitempty" json:"health_check,omitempty"`       // 上游健康检查
+	Fallback     *FallbackResponse  `yaml:"fallback,omitempty" json:"fallback,omitempty"`               // 没有可用上游时返回的兜底响应
+	Retry        *RetryConfig       `yaml:"retry,omitempty" json:"retry,omitempty"`                     // 重试策略
+	Breaker      *BreakerConfig     `yaml:"circuit_breaker,omitempty" json:"circuit_breaker,omitempty"` // 熔断器
+	Transport    *TransportConfig   `yaml:"transport,omitempty" json:"transport,omitempty"`             // 上游连接池配置
+	TLS          *UpstreamTLSConfig `yaml:"tls,omitempty" json:"tls,omitempty"`                         // 上游 HTTPS 的 TLS 配置
+	GRPC         *GRPCConfig        `yaml:"grpc,omitempty" json:"grpc,omitempty"`                       // gRPC 转发配置
+	Transform    *TransformConfig   `yaml:"transform,omitempty" json:"transform,omitempty"`             // 请求和响应的头部、Cookie、查询参数转换
+	Composite    *CompositeConfig   `yaml:"composite,omitempty" json:"composite,omitempty"`             // 聚合配置：向多个上游发起子请求并合并结果（配置后忽略 Target 和 Targets）
+
+	specificity *Specificity // 匹配条件的具体程度，配置加载时计算
+}
+
+// GRPCConfig gRPC 转发配置
+// gRPC 请求（HTTP/2，Content-Type 为 application/grpc）总是以 HTTP/2 转发到上游，http:// 目标使用 h2c，https:// 目标使用 h2
+type GRPCConfig struct {
+	Web bool `yaml:"web,omitempty" json:"web,omitempty"` // 把浏览器的 gRPC-Web 请求转换为 gRPC 转发，响应再转换回 gRPC-Web
+}
+
+// UpstreamTarget 上游目标实例
+type UpstreamTarget struct {
+	URL    string `yaml:"url" json:"url"`                           // 目标地址
+	Weight int    `yaml:"weight,omitempty" json:"weight,omitempty"` // 权重（默认 1）
+	Drain  bool   `yaml:"drain,omitempty" json:"drain,omitempty"`   // 摘除流量，不再分配新请求
+}
+
+// LoadBalanceConfig 负载均衡配置
+type LoadBalanceConfig struct {
+	Strategy string `yaml:"strategy,omitempty" json:"strategy,omitempty"` // round_robin（默认）、weighted_random、least_conn、consistent_hash
+	HashKey  string `yaml:"hash_key,omitempty" json:"hash_key,omitempty"` // 一致性哈希的键，如 header:X-User-Id、cookie:session_id
+}
+
+// HealthCheckConfig 健康检查配置
+type HealthCheckConfig struct {
+	Path           string `yaml:"path,omitempty" json:"path,omitempty"`                       // 主动探测路径，留空表示不主动探测
+	Interval       int    `yaml:"interval,omitempty" json:"interval,omitempty"`               // 主动探测间隔（秒，默认 10）
+	Timeout        int    `yaml:"timeout,omitempty" json:"timeout,omitempty"`                 // 主动探测超时（秒，默认 2）
+	ExpectedStatus int    `yaml:"expected_status,omitempty" json:"expected_status,omitempty"` // 期望的状态码，未配置时 2xx/3xx 都视为健康
+	MaxFails       int    `yaml:"max_fails,omitempty" json:"max_fails,omitempty"`             // 被动检查：连续失败多少次后摘除，0 表示不启用
+	FailTimeout    int    `yaml:"fail_timeout,omitempty" json:"fail_timeout,omitempty"`       // 被动摘除持续时间（秒，默认 30）
+}
+
+// FallbackResponse 兜底响应
+type FallbackResponse struct {
+	StatusCode int               `yaml:"status_code" json:"status_code"`             // 状态码（默认 503）
+	Headers    map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"` // 响应头
+	Body       string            `yaml:"body,omitempty" json:"body,omitempty"`       // 响应体
+}
+
+// RetryConfig 重试策略
+type RetryConfig struct {
+	Attempts         int      `yaml:"attempts" json:"attempts"`                                         // 最大尝试次数（包含第一次），小于 2 表示不重试
+	On               []string `yaml:"on,omitempty" json:"on,omitempty"`                                 // 可重试的错误：connect_error、timeout，与 status_codes 都未配置时默认两者都重试
+	StatusCodes      []int    `yaml:"status_codes,omitempty" json:"status_codes,omitempty"`             // 可重试的上游状态码
+	BackoffBase      int      `yaml:"backoff_base,omitempty" json:"backoff_base,omitempty"`             // 退避基础时间（毫秒，默认 100），每次重试翻倍
+	BackoffMax       int      `yaml:"backoff_max,omitempty" json:"backoff_max,omitempty"`               // 退避最长时间（毫秒，默认 2000）
+	NonIdempotent    bool     `yaml:"non_idempotent,omitempty" json:"non_idempotent,omitempty"`         // 是否允许重试非幂等方法（POST、PATCH）
+	BudgetPercent    int      `yaml:"budget_percent,omitempty" json:"budget_percent,omitempty"`         // 重试预算：10 秒内重试次数占请求数的最大百分比（默认 20）
+	BudgetMinRetries int      `yaml:"budget_min_retries,omitempty" json:"budget_min_retries,omitempty"` // 10 秒内始终允许的最少重试次数（默认 3）
+}
+
+// BreakerConfig 熔断器配置，熔断状态按上游目标保存
+type BreakerConfig struct {
+	Window           int `yaml:"window,omitempty" json:"window,omitempty"`                         // 统计窗口（秒，默认 10）
+	MinRequests      int `yaml:"min_requests,omitempty" json:"min_requests,omitempty"`             // 窗口内至少多少个请求才判断是否熔断（默认 10）
+	FailureRate      int `yaml:"failure_rate,omitempty" json:"failure_rate,omitempty"`             // 失败率阈值（百分比，默认 50）
+	SlowThreshold    int `yaml:"slow_threshold,omitempty" json:"slow_threshold,omitempty"`         // 慢请求阈值（毫秒），0 表示不统计慢请求
+	SlowRate         int `yaml:"slow_rate,omitempty" json:"slow_rate,omitempty"`                   // 慢请求比例阈值（百分比，默认 50）
+	CoolDown         int `yaml:"cool_down,omitempty" json:"cool_down,omitempty"`                   // 熔断持续时间（秒，默认 30），到期后进入半开状态
+	HalfOpenRequests int `yaml:"half_open_requests,omitempty" json:"half_open_requests,omitempty"` // 半开状态允许通过的探测请求数（默认 1），全部成功后关闭熔断
+}
+
+// TransportConfig 上游连接池配置，配置相同的目标共享连接池
+type TransportConfig struct {
+	MaxIdleConnsPerHost   int  `yaml:"max_idle_conns_per_host,omitempty" json:"max_idle_conns_per_host,omitempty"` // 每个主机最多保留的空闲连接数（默认 100）
+	MaxConnsPerHost       int  `yaml:"max_conns_per_host,omitempty" json:"max_conns_per_host,omitempty"`           // 每个主机最大连接数，0 表示不限制
+	IdleConnTimeout       int  `yaml:"idle_conn_timeout,omitempty" json:"idle_conn_timeout,omitempty"`             // 空闲连接超时（秒，默认 90）
+	DialTimeout           int  `yaml:"dial_timeout,omitempty" json:"dial_timeout,omitempty"`                       // 建立连接超时（秒，默认 30）
+	TLSHandshakeTimeout   int  `yaml:"tls_handshake_timeout,omitempty" json:"tls_handshake_timeout,omitempty"`     // TLS 握手超时（秒，默认 10）
+	KeepAlive             int  `yaml:"keep_alive,omitempty" json:"keep_alive,omitempty"`                           // TCP keep-alive 间隔（秒，默认 30）
+	DisableKeepAlives     bool `yaml:"disable_keep_alives,omitempty" json:"disable_keep_alives,omitempty"`         // 禁用连接复用，每个请求使用新连接
+	DisableHTTP2          bool `yaml:"disable_http2,omitempty" json:"disable_http2,omitempty"`                     // 禁用 HTTP/2（仅 HTTPS 上游会协商 HTTP/2）
+	ResponseHeaderTimeout int  `yaml:"response_header_timeout,omitempty" json:"response_header_timeout,omitempty"` // 等待响应头超时（秒），0 表示只受规则超时限制
+}
+
+// UpstreamTLSConfig 连接上游 HTTPS 服务时使用的 TLS 配置，证书文件在加载配置时读取和校验，配置热加载时重新读取
+type UpstreamTLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty" json:"ca_file,omitempty"`                           // 额外信任的 CA 证书文件（PEM），与系统 CA 一起使用
+	CertFile           string `yaml:"cert_file,omitempty" json:"cert_file,omitempty"`                       // mTLS 客户端证书文件（PEM）
+	KeyFile            string `yaml:"key_file,omitempty" json:"key_file,omitempty"`                         // mTLS 客户端私钥文件（PEM）
+	ServerName         string `yaml:"server_name,omitempty" json:"server_name,omitempty"`                   // SNI 和证书校验使用的主机名，默认使用目标地址的主机名
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"` // 跳过证书校验（仅用于自签名证书的开发环境）
+
+	tlsConfig *tls.Config // 读取证书文件后生成的配置，加载配置时生成
+}
+
+// 可重试的错误类型
+const (
+	RetryOnConnectError = "connect_error"
+	RetryOnTimeout      = "timeout"
+)
+
+// 负载均衡策略
+const (
+	LoadBalanceRoundRobin     = "round_robin"
+	LoadBalanceWeightedRandom = "weighted_random"
+	LoadBalanceLeastConn      = "least_conn"
+	LoadBalanceConsistentHash = "consistent_hash"
+)
+
+// UpstreamTargets 返回规则的所有上游目标，只配置了 Target 时返回单个目标，聚合规则返回所有子请求的上游地址
+func (r *ProxyRule) UpstreamTargets() []UpstreamTarget {
+	if r.Composite != nil {
+		return r.Composite.compositeTargets()
+	}
+	if len(r.Targets) > 0 {
+		return r.Targets
+	}
+	if r.Target == "" {
+		return nil
+	}
+	return []UpstreamTarget{{URL: r.Target, Weight: 1}}
 }
 
 // MatchCondition 匹配条件
 type MatchCondition struct {
-	Path    string            `yaml:"path" json:"path"`         // 路径匹配（支持前缀匹配）
-	Method  string            `yaml:"method" json:"method"`     // HTTP 方法
-	Headers map[string]string `yaml:"headers" json:"headers"`   // Header 匹配
-	Query   map[string]string `yaml:"query" json:"query"`        // Query 参数匹配
-	Body    map[string]string `yaml:"body" json:"body"`         // Body 参数匹配（仅支持 JSON）
+	Path       string                     `yaml:"path" json:"path"`                                   // 路径匹配，匹配方式由 PathType 决定
+	PathType   string                     `yaml:"path_type,omitempty" json:"path_type,omitempty"`     // 路径匹配方式：prefix（默认）、segment、exact、glob、regex
+	PathNegate bool                       `yaml:"path_negate,omitempty" json:"path_negate,omitempty"` // 取反：路径不匹配时才算匹配
+	Method     string                     `yaml:"method" json:"method"`                               // HTTP 方法
+	Headers    map[string]*ValueCondition `yaml:"headers" json:"headers"`                             // Header 匹配，值可以是字符串或带运算符的条件
+	Query      map[string]*ValueCondition `yaml:"query" json:"query"`                                 // Query 参数匹配，值可以是字符串或带运算符的条件
+	Body       map[string]*ValueCondition `yaml:"body" json:"body"`                                   // Body 参数匹配（按 Content-Type 解析 JSON、表单或 XML），值可以是字符串或带运算符的条件
+	All        []MatchCondition           `yaml:"all,omitempty" json:"all,omitempty"`                 // 子条件全部满足
+	Any        []MatchCondition           `yaml:"any,omitempty" json:"any,omitempty"`                 // 子条件任意一个满足
+	Not        *MatchCondition            `yaml:"not,omitempty" json:"not,omitempty"`                 // 子条件不满足
+	GraphQL    *GraphQLMatch              `yaml:"graphql,omitempty" json:"graphql,omitempty"`         // GraphQL 操作匹配
+
+	pathMatcher *PathMatcher // 编译后的路径匹配器
+}
+
+// GraphQLMatch GraphQL 操作匹配，从 POST 请求体或 GET 的 query 参数中解析
+type GraphQLMatch struct {
+	OperationName *ValueCondition `yaml:"operation_name,omitempty" json:"operation_name,omitempty"` // 操作名，可以是字符串或带运算符的条件
+	OperationType string          `yaml:"operation_type,omitempty" json:"operation_type,omitempty"` // 操作类型：query、mutation、subscription
+	Fields        []string        `yaml:"fields,omitempty" json:"fields,omitempty"`                 // 顶层字段，包含任意一个即可
 }
 
 // LogConfig 日志配置
@@ -65,6 +244,7 @@ type LogConfig struct {
 	MaxSize    int    `yaml:"max_size" json:"max_size"`       // 最大文件大小（MB）
 	MaxBackups int    `yaml:"max_backups" json:"max_backups"` // 保留的备份文件数
 	MaxAge     int    `yaml:"max_age" json:"max_age"`         // 保留天数
+	MaxBodySize int    `yaml:"max_body_size" json:"max_body_size"` // 日志中记录的请求体/响应体最大字节数
 }
 
 // LoadConfig 加载配置
@@ -79,6 +259,11 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("解析配置文件失败: %w", err)
 	}
 
+	// 校验并编译规则，只在加载时编译一次
+	if err := compileRules(&cfg); err != nil {
+		return nil, err
+	}
+
 	// 设置默认值
 	// 如果端口未配置，使用默认值 8080
 	if cfg.Server.Port == 0 {
@@ -98,6 +283,9 @@ func LoadConfig(path string) (*Config, error) {
 	if cfg.Log.MaxAge == 0 {
 		cfg.Log.MaxAge = 30
 	}
+	if cfg.Log.MaxBodySize == 0 {
+		cfg.Log.MaxBodySize = 10240
+	}
 	// 管理后台认证配置默认值
 	if cfg.AdminAuth.CookieKey == "" {
 		cfg.AdminAuth.CookieKey = "bff_admin_token"
@@ -106,18 +294,33 @@ func LoadConfig(path string) (*Config, error) {
 		cfg.AdminAuth.CookieValue = "change_me_in_production"
 	}
 
-	configMutex.Lock()
-	globalConfig = &cfg
-	configMutex.Unlock()
+	setConfig(&cfg)
 
 	return &cfg, nil
 }
 
 // GetConfig 获取当前配置
 func GetConfig() *Config {
-	configMutex.RLock()
-	defer configMutex.RUnlock()
-	return globalConfig
+	return globalConfig.Load()
+}
+
+// OnChange 注册配置变更回调，LoadConfig 和 SaveConfig 更新配置后调用
+func OnChange(fn func(cfg *Config)) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	listeners = append(listeners, fn)
+}
+
+// setConfig 更新内存中的配置并通知回调
+func setConfig(cfg *Config) {
+	configMutex.Lock()
+	globalConfig.Store(cfg)
+	callbacks := append([]func(cfg *Config){}, listeners...)
+	configMutex.Unlock()
+
+	for _, fn := range callbacks {
+		fn(cfg)
+	}
 }
 
 // SaveConfig 保存配置
@@ -141,6 +344,9 @@ func SaveConfig(cfg *Config, path string) error {
 	if cfg.Log.MaxAge == 0 {
 		cfg.Log.MaxAge = 30
 	}
+	if cfg.Log.MaxBodySize == 0 {
+		cfg.Log.MaxBodySize = 10240
+	}
 	// 管理后台认证配置默认值
 	if cfg.AdminAuth.CookieKey == "" {
 		cfg.AdminAuth.CookieKey = "bff_admin_token"
@@ -156,19 +362,24 @@ func SaveConfig(cfg *Config, path string) error {
 			rule.Timeout = 30
 		}
 		if rule.Match.Headers == nil {
-			rule.Match.Headers = make(map[string]string)
+			rule.Match.Headers = make(map[string]*ValueCondition)
 		}
 		if rule.Match.Query == nil {
-			rule.Match.Query = make(map[string]string)
+			rule.Match.Query = make(map[string]*ValueCondition)
 		}
 		if rule.Match.Body == nil {
-			rule.Match.Body = make(map[string]string)
+			rule.Match.Body = make(map[string]*ValueCondition)
 		}
 		if rule.Headers == nil {
 			rule.Headers = make(map[string]string)
 		}
 	}
 
+	// 校验并编译规则，配置无效时不写入文件
+	if err := compileRules(cfg); err != nil {
+		return err
+	}
+
 	data, err := yaml.Marshal(cfg)
 	if err != nil {
 		return fmt.Errorf("序列化配置失败: %w", err)
@@ -179,9 +390,7 @@ func SaveConfig(cfg *Config, path string) error {
 	}
 
 	// 更新内存中的配置
-	configMutex.Lock()
-	globalConfig = cfg
-	configMutex.Unlock()
+	setConfig(cfg)
 
 	return nil
 }
@@ -209,6 +418,8 @@ func WatchConfig(path string, callback func()) {
 				time.Sleep(100 * time.Millisecond)
 				if _, err := LoadConfig(path); err == nil {
 					callback()
+				} else {
+					fmt.Printf("重新加载配置失败，继续使用旧配置: %v\n", err)
 				}
 			}
 		case err, ok := <-watcher.Errors:
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// 转发请求头
+const (
+	ForwardedFor   = "X-Forwarded-For"
+	ForwardedProto = "X-Forwarded-Proto"
+	ForwardedHost  = "X-Forwarded-Host"
+	RealIP         = "X-Real-Ip"
+	Forwarded      = "Forwarded" // RFC 7239
+)
+
+// InternalHopHeader 内置的 HTTPS、h2c 监听把请求交给主 HTTP 端口时添加的请求头，值为本进程的随机令牌，
+// 主端口校验后删除，不会转发给上游；客户端无法伪造，只有带着正确令牌的回环请求才不计入转发链
+const InternalHopHeader = "X-Bff-Internal-Hop"
+
+// internalHopToken 进程启动时生成的内部转发令牌
+var internalHopToken = func() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("生成内部转发令牌失败: %v", err))
+	}
+	return hex.EncodeToString(b)
+}()
+
+// InternalHopToken 返回本进程的内部转发令牌
+func InternalHopToken() string {
+	return internalHopToken
+}
+
+// ForwardingHeaders 所有转发请求头，来自不受信任地址的请求中的这些请求头都会被删除
+var ForwardingHeaders = []string{ForwardedFor, ForwardedProto, ForwardedHost, RealIP, Forwarded}
+
+// defaultForwardingHeaders 未配置 headers 时添加的转发请求头
+var defaultForwardingHeaders = []string{ForwardedFor, ForwardedProto, ForwardedHost}
+
+// ForwardingConfig 转发请求头配置
+type ForwardingConfig struct {
+	Headers        []string `yaml:"headers,omitempty" json:"headers,omitempty"`                 // 添加的转发请求头：x-forwarded-for、x-forwarded-proto、x-forwarded-host、x-real-ip、forwarded，默认前三个
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty" json:"trusted_proxies,omitempty"` // 受信任的代理（CIDR 或 IP），来自这些地址的请求保留已有的转发请求头并追加
+
+	headers []string
+	trusted []*net.IPNet
+}
+
+// compile 校验转发请求头名称，解析受信任的代理地址
+func (f *ForwardingConfig) compile() error {
+	headers, err := parseForwardingHeaders(f.Headers)
+	if err != nil {
+		return err
+	}
+	trusted, err := parseTrustedProxies(f.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	f.headers, f.trusted = headers, trusted
+	return nil
+}
+
+// Enabled 是否添加指定的转发请求头
+func (f *ForwardingConfig) Enabled(header string) bool {
+	headers := f.headers
+	if headers == nil {
+		// 没有经过 LoadConfig/SaveConfig 的配置，临时解析
+		headers, _ = parseForwardingHeaders(f.Headers)
+	}
+	return slices.Contains(headers, header)
+}
+
+// Trusted 判断地址是否是受信任的代理
+func (f *ForwardingConfig) Trusted(ip net.IP) bool {
+	trusted := f.trusted
+	if trusted == nil {
+		// 没有经过 LoadConfig/SaveConfig 的配置，临时解析
+		trusted, _ = parseTrustedProxies(f.TrustedProxies)
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseForwardingHeaders 把配置的请求头名称转换为规范格式，未配置时使用默认值
+func parseForwardingHeaders(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return defaultForwardingHeaders, nil
+	}
+	headers := make([]string, 0, len(names))
+	for _, name := range names {
+		header := http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if !slices.Contains(ForwardingHeaders, header) {
+			return nil, fmt.Errorf("不支持的转发请求头 %q（支持 x-forwarded-for、x-forwarded-proto、x-forwarded-host、x-real-ip、forwarded）", name)
+		}
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+// parseTrustedProxies 解析受信任的代理地址，单个 IP 视为只包含该地址的网段
+func parseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	trusted := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的受信任代理地址 %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("无效的受信任代理网段 %q: %w", value, err)
+		}
+		trusted = append(trusted, network)
+	}
+	return trusted, nil
+}
@@ -0,0 +1,233 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 路径匹配方式
+const (
+	PathTypePrefix  = "prefix"  // 前缀匹配（默认）：/api 匹配 /api、/api/users，也匹配 /apiv2
+	PathTypeSegment = "segment" // 按路径段前缀匹配：/api 匹配 /api、/api/users，不匹配 /apiv2
+	PathTypeExact   = "exact"   // 完全匹配
+	PathTypeGlob    = "glob"    // 通配符：* 匹配一段内任意字符，** 匹配任意多段，{name} 捕获一段
+	PathTypeRegex   = "regex"   // 正则表达式，支持 (?P<name>...) 命名捕获
+)
+
+// paramNamePattern 通配符中 {name} 参数名的格式
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// PathMatcher 编译后的路径匹配器，配置加载时创建
+type PathMatcher struct {
+	pathType string
+	pattern  string
+	negate   bool
+	re       *regexp.Regexp // glob 和 regex 使用
+}
+
+// compile 校验并编译匹配条件（包括子条件）
+func (m *MatchCondition) compile() error {
+	matcher, err := newPathMatcher(m.Path, m.PathType, m.PathNegate)
+	if err != nil {
+		return err
+	}
+	m.pathMatcher = matcher
+
+	if err := compileConditions("Header", m.Headers); err != nil {
+		return err
+	}
+	if err := compileConditions("Query 参数", m.Query); err != nil {
+		return err
+	}
+	if err := compileConditions("Body 参数", m.Body); err != nil {
+		return err
+	}
+	if m.GraphQL != nil {
+		if err := m.GraphQL.compile(); err != nil {
+			return err
+		}
+	}
+	for i := range m.All {
+		if err := m.All[i].compile(); err != nil {
+			return fmt.Errorf("all 第 %d 个子条件: %w", i+1, err)
+		}
+	}
+	for i := range m.Any {
+		if err := m.Any[i].compile(); err != nil {
+			return fmt.Errorf("any 第 %d 个子条件: %w", i+1, err)
+		}
+	}
+	if m.Not != nil {
+		if err := m.Not.compile(); err != nil {
+			return fmt.Errorf("not 子条件: %w", err)
+		}
+	}
+	return nil
+}
+
+// MatchPath 匹配请求路径，返回命名捕获的路径参数
+func (m *MatchCondition) MatchPath(path string) (map[string]string, bool) {
+	matcher := m.pathMatcher
+	if matcher == nil {
+		// 没有经过 LoadConfig/SaveConfig 的配置，临时编译
+		var err error
+		if matcher, err = newPathMatcher(m.Path, m.PathType, m.PathNegate); err != nil {
+			return nil, false
+		}
+	}
+	return matcher.Match(path)
+}
+
+// newPathMatcher 根据匹配方式编译路径匹配器
+func newPathMatcher(pattern, pathType string, negate bool) (*PathMatcher, error) {
+	if pathType == "" {
+		pathType = PathTypePrefix
+	}
+	matcher := &PathMatcher{pathType: pathType, pattern: pattern, negate: negate}
+
+	switch pathType {
+	case PathTypePrefix, PathTypeExact:
+	case PathTypeSegment:
+		// 去掉末尾的 /，/api/ 与 /api 等价
+		if pattern != "/" {
+			matcher.pattern = strings.TrimSuffix(pattern, "/")
+		}
+	case PathTypeGlob:
+		expr, err := globToRegexp(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if matcher.re, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("编译通配符 %q 失败: %w", pattern, err)
+		}
+	case PathTypeRegex:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("编译正则表达式 %q 失败: %w", pattern, err)
+		}
+		matcher.re = re
+	default:
+		return nil, fmt.Errorf("未知的路径匹配方式 %q（支持 prefix、segment、exact、glob、regex）", pathType)
+	}
+	return matcher, nil
+}
+
+// Match 匹配请求路径，返回命名捕获的路径参数
+func (m *PathMatcher) Match(path string) (map[string]string, bool) {
+	params, ok := m.match(path)
+	if m.negate {
+		return nil, !ok
+	}
+	return params, ok
+}
+
+// match 不考虑取反的匹配
+func (m *PathMatcher) match(path string) (map[string]string, bool) {
+	// 未配置路径时匹配所有请求
+	if m.pattern == "" {
+		return nil, true
+	}
+
+	switch m.pathType {
+	case PathTypeExact:
+		return nil, path == m.pattern
+	case PathTypeSegment:
+		if m.pattern == "/" || path == m.pattern {
+			return nil, true
+		}
+		return nil, strings.HasPrefix(path, m.pattern+"/")
+	case PathTypeGlob, PathTypeRegex:
+		match := m.re.FindStringSubmatch(path)
+		if match == nil {
+			return nil, false
+		}
+		var params map[string]string
+		for i, name := range m.re.SubexpNames() {
+			if name == "" {
+				continue
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[name] = match[i]
+		}
+		return params, true
+	default:
+		return nil, strings.HasPrefix(path, m.pattern)
+	}
+}
+
+// globToRegexp 把通配符转换为完整匹配的正则表达式
+// * 匹配一段内的任意字符，? 匹配一段内的单个字符，** 匹配任意多段（包括零段），{name} 捕获一段
+func globToRegexp(pattern string) (string, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); {
+		switch {
+		case strings.HasPrefix(pattern[i:], "/**") && (i+3 == len(pattern) || pattern[i+3] == '/'):
+			// /** 可以匹配零段
+			b.WriteString("(?:/.*)?")
+			i += 3
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i += 2
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+			i++
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+			i++
+		case pattern[i] == '{':
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("通配符 %q 中的 { 没有闭合", pattern)
+			}
+			name := pattern[i+1 : i+end]
+			if !paramNamePattern.MatchString(name) {
+				return "", fmt.Errorf("通配符 %q 中的参数名 %q 无效", pattern, name)
+			}
+			b.WriteString("(?P<" + name + ">[^/]+)")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			i++
+		}
+	}
+	b.WriteString("$")
+	return b.String(), nil
+}
+
+// compileRules 校验并编译所有规则和转发请求头配置，配置无效时返回错误
+func compileRules(cfg *Config) error {
+	for i := range cfg.Proxy.Rules {
+		rule := &cfg.Proxy.Rules[i]
+		if err := rule.Match.compile(); err != nil {
+			return fmt.Errorf("规则 %q 的匹配条件无效: %w", rule.Name, err)
+		}
+		if rule.Rewrite != nil {
+			if err := rule.Rewrite.compile(); err != nil {
+				return fmt.Errorf("规则 %q 的重写配置无效: %w", rule.Name, err)
+			}
+		}
+		if rule.Transform != nil {
+			if err := rule.Transform.compile(); err != nil {
+				return fmt.Errorf("规则 %q 的转换配置无效: %w", rule.Name, err)
+			}
+		}
+		if rule.Composite != nil {
+			if err := rule.Composite.compile(); err != nil {
+				return fmt.Errorf("规则 %q 的聚合配置无效: %w", rule.Name, err)
+			}
+		}
+		if rule.TLS != nil {
+			if err := rule.TLS.compile(); err != nil {
+				return fmt.Errorf("规则 %q 的上游 TLS 配置无效: %w", rule.Name, err)
+			}
+		}
+	}
+	if err := cfg.Proxy.Forwarding.compile(); err != nil {
+		return fmt.Errorf("转发请求头配置无效: %w", err)
+	}
+	return cfg.Proxy.compileRoutes()
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// 规则匹配模式
+const (
+	MatchModeFirst = "first" // 按优先级和配置顺序，第一个匹配的规则生效（默认）
+	MatchModeBest  = "best"  // 同一优先级中最具体的规则生效
+)
+
+// Specificity 规则的具体程度，best 匹配模式下用于在同一优先级的多个匹配规则中选择
+type Specificity struct {
+	PathLength int  // 路径中固定部分的长度（通配符、参数、正则中的非字面量部分不计算）
+	Exact      bool // 路径完全匹配
+	Conditions int  // 路径以外的条件数量（方法、Header、Query、Body、GraphQL 和子条件）
+}
+
+// MoreSpecific 是否比 other 更具体：依次比较路径长度、是否完全匹配、条件数量
+func (s Specificity) MoreSpecific(other Specificity) bool {
+	if s.PathLength != other.PathLength {
+		return s.PathLength > other.PathLength
+	}
+	if s.Exact != other.Exact {
+		return s.Exact
+	}
+	return s.Conditions > other.Conditions
+}
+
+// Specificity 返回规则的具体程度
+func (r *ProxyRule) Specificity() Specificity {
+	if r.specificity == nil {
+		// 没有经过 LoadConfig/SaveConfig 的配置，临时计算
+		return r.Match.specificity()
+	}
+	return *r.specificity
+}
+
+// specificity 计算匹配条件的具体程度
+func (m *MatchCondition) specificity() Specificity {
+	s := Specificity{Conditions: m.conditionCount()}
+	if m.Path == "" {
+		return s
+	}
+	if m.PathNegate {
+		// 取反的路径只算作一个条件
+		s.Conditions++
+		return s
+	}
+
+	switch m.pathType() {
+	case PathTypeExact:
+		s.PathLength = len(m.Path)
+		s.Exact = true
+	case PathTypeGlob:
+		s.PathLength = globLiteralLength(m.Path)
+	case PathTypeRegex:
+		if re, err := regexp.Compile(m.Path); err == nil {
+			prefix, _ := re.LiteralPrefix()
+			s.PathLength = len(prefix)
+		}
+	default:
+		s.PathLength = len(m.Path)
+	}
+	return s
+}
+
+// conditionCount 路径以外的条件数量，any 子条件整体算作一个条件
+func (m *MatchCondition) conditionCount() int {
+	n := len(m.Headers) + len(m.Query) + len(m.Body)
+	if m.Method != "" {
+		n++
+	}
+	if g := m.GraphQL; g != nil {
+		if g.OperationName != nil {
+			n++
+		}
+		if g.OperationType != "" {
+			n++
+		}
+		n += len(g.Fields)
+	}
+	for i := range m.All {
+		n += m.All[i].conditionCount()
+		if m.All[i].Path != "" {
+			n++
+		}
+	}
+	if len(m.Any) > 0 {
+		n++
+	}
+	if m.Not != nil {
+		n++
+	}
+	return n
+}
+
+// pathType 返回路径匹配方式，未配置时为 prefix
+func (m *MatchCondition) pathType() string {
+	if m.PathType == "" {
+		return PathTypePrefix
+	}
+	return m.PathType
+}
+
+// globLiteralLength 通配符中固定字符的数量，*、? 和 {name} 不计算
+func globLiteralLength(pattern string) int {
+	n := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?':
+		case '{':
+			if end := strings.IndexByte(pattern[i:], '}'); end > 0 {
+				i += end
+			}
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// globLiteralPrefix 通配符能匹配的路径一定以返回值开头
+// 到第一个 *、? 或 {name} 为止；/** 可以匹配零段，前面的 / 也不包括在内
+func globLiteralPrefix(pattern string) string {
+	i := strings.IndexAny(pattern, "*?{")
+	if i < 0 {
+		return pattern
+	}
+	if strings.HasPrefix(pattern[i:], "**") && i > 0 && pattern[i-1] == '/' {
+		return pattern[:i-1]
+	}
+	return pattern[:i]
+}
+
+// RuleOrder 返回规则的匹配顺序（规则下标）：按优先级从高到低，同一优先级保持配置顺序
+func (p *ProxyConfig) RuleOrder() []int {
+	return p.Routes().order
+}
+
+// Routes 返回编译后的路由表
+func (p *ProxyConfig) Routes() *RouteTable {
+	if p.routes != nil {
+		return p.routes
+	}
+	// 没有经过 LoadConfig/SaveConfig 的配置，临时创建
+	return newRouteTable(p.Rules)
+}
+
+// ruleOrder 计算规则的匹配顺序
+func ruleOrder(rules []ProxyRule) []int {
+	order := make([]int, len(rules))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return rules[order[i]].Priority > rules[order[j]].Priority
+	})
+	return order
+}
+
+// compileRoutes 校验匹配模式，计算规则的具体程度并创建路由表
+func (p *ProxyConfig) compileRoutes() error {
+	switch p.MatchMode {
+	case "", MatchModeFirst, MatchModeBest:
+	default:
+		return fmt.Errorf("未知的匹配模式 %q（支持 first、best）", p.MatchMode)
+	}
+	for i := range p.Rules {
+		s := p.Rules[i].Match.specificity()
+		p.Rules[i].specificity = &s
+	}
+	p.routes = newRouteTable(p.Rules)
+	return nil
+}
+
+// prefer 判断同时匹配一个请求时 a 是否优先于 b 生效，a 在匹配顺序中位于 b 之前
+func (p *ProxyConfig) prefer(a, b *ProxyRule) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if p.MatchMode == MatchModeBest {
+		return !b.Specificity().MoreSpecific(a.Specificity())
+	}
+	return true
+}
+
+// ShadowedRules 检查永远不会生效的规则：能匹配它的请求都会被另一个优先的规则匹配
+// 只检查能够静态判断的情况（路径前缀包含、条件是子集），返回告警信息
+func (p *ProxyConfig) ShadowedRules() []string {
+	order := p.RuleOrder()
+	warnings := []string{}
+	for j, bi := range order {
+		b := &p.Rules[bi]
+		for _, ai := range order[:j] {
+			a := &p.Rules[ai]
+			if p.prefer(a, b) && a.Match.covers(&b.Match) {
+				warnings = append(warnings, fmt.Sprintf("规则 %q 不会生效：能匹配它的请求都会先匹配规则 %q", b.Name, a.Name))
+				break
+			}
+		}
+	}
+	return warnings
+}
+
+// covers 判断满足 other 的请求是否一定满足 m（m 的每一项条件在 other 中都有相同或更严格的条件）
+// 无法静态判断时返回 false
+func (m *MatchCondition) covers(other *MatchCondition) bool {
+	if !m.pathCovers(other) {
+		return false
+	}
+	if m.Method != "" && !strings.EqualFold(m.Method, other.Method) {
+		return false
+	}
+	if !conditionsCovered(m.Headers, other.Headers, true) ||
+		!conditionsCovered(m.Query, other.Query, false) ||
+		!conditionsCovered(m.Body, other.Body, false) {
+		return false
+	}
+	// GraphQL 和子条件只有完全相同时才能判断
+	if m.GraphQL != nil && !sameJSON(m.GraphQL, other.GraphQL) {
+		return false
+	}
+	if len(m.All) > 0 && !sameJSON(m.All, other.All) {
+		return false
+	}
+	if len(m.Any) > 0 && !sameJSON(m.Any, other.Any) {
+		return false
+	}
+	if m.Not != nil && !sameJSON(m.Not, other.Not) {
+		return false
+	}
+	return true
+}
+
+// pathCovers 判断能匹配 other 路径的请求是否一定匹配 m 的路径
+func (m *MatchCondition) pathCovers(other *MatchCondition) bool {
+	if m.Path == "" && !m.PathNegate {
+		return true
+	}
+	mt, ot := m.pathType(), other.pathType()
+	if m.PathNegate || other.PathNegate || other.Path == "" {
+		return m.PathNegate == other.PathNegate && mt == ot && m.Path == other.Path
+	}
+
+	// 另一个路径能匹配的请求都以 literal 开头
+	literal := other.Path
+	switch ot {
+	case PathTypeGlob:
+		literal = globLiteralPrefix(other.Path)
+	case PathTypeRegex:
+		if mt == PathTypeRegex {
+			return m.Path == other.Path
+		}
+		return false
+	}
+
+	switch mt {
+	case PathTypePrefix:
+		return strings.HasPrefix(literal, m.Path)
+	case PathTypeSegment:
+		prefix := strings.TrimSuffix(m.Path, "/")
+		if m.Path == "/" {
+			return strings.HasPrefix(literal, "/")
+		}
+		if ot == PathTypeExact || ot == PathTypeSegment {
+			if strings.TrimSuffix(other.Path, "/") == prefix {
+				return true
+			}
+		}
+		return strings.HasPrefix(literal, prefix+"/")
+	case PathTypeExact:
+		return ot == PathTypeExact && m.Path == other.Path
+	default:
+		return mt == ot && m.Path == other.Path
+	}
+}
+
+// conditionsCovered 判断 conditions 中的每个条件在 other 中都有相同的条件
+func conditionsCovered(conditions, other map[string]*ValueCondition, ignoreKeyCase bool) bool {
+	for key, cond := range conditions {
+		found := false
+		for otherKey, otherCond := range other {
+			if (otherKey == key || (ignoreKeyCase && strings.EqualFold(otherKey, key))) && sameCondition(cond, otherCond) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// sameCondition 判断两个值匹配条件是否相同
+func sameCondition(a, b *ValueCondition) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	op := func(v *ValueCondition) string {
+		if v.Op == "" {
+			return OpEq
+		}
+		return v.Op
+	}
+	return op(a) == op(b) && a.Value == b.Value && a.IgnoreCase == b.IgnoreCase && a.Negate == b.Negate && slices.Equal(a.Values, b.Values)
+}
+
+// sameJSON 按 JSON 序列化结果判断两个配置是否相同
+func sameJSON(a, b interface{}) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	return err == nil && string(x) == string(y)
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RewriteConfig 请求路径和查询参数重写
+// 路径按 strip_prefix、regex、template、add_prefix 的顺序处理
+type RewriteConfig struct {
+	StripPrefix string        `yaml:"strip_prefix,omitempty" json:"strip_prefix,omitempty"` // 去掉路径前缀
+	Regex       string        `yaml:"regex,omitempty" json:"regex,omitempty"`               // 路径正则，与 replacement 一起使用
+	Replacement string        `yaml:"replacement,omitempty" json:"replacement,omitempty"`   // 正则替换结果，支持 $1、${name} 引用捕获组
+	Template    string        `yaml:"template,omitempty" json:"template,omitempty"`         // 路径模板，支持 {path}、{path.name}、{header.Name}、{query.name}、{cookie.name}、{method}、{client_ip}、{request_id}、{env.NAME}
+	AddPrefix   string        `yaml:"add_prefix,omitempty" json:"add_prefix,omitempty"`     // 添加路径前缀
+	Query       *QueryRewrite `yaml:"query,omitempty" json:"query,omitempty"`               // 查询参数重写
+
+	re       *regexp.Regexp
+	template *Template
+}
+
+// QueryRewrite 查询参数重写，按 remove、rename、set 的顺序处理
+type QueryRewrite struct {
+	Remove []string          `yaml:"remove,omitempty" json:"remove,omitempty"` // 删除的参数
+	Rename map[string]string `yaml:"rename,omitempty" json:"rename,omitempty"` // 重命名参数：旧名 -> 新名
+	Set    map[string]string `yaml:"set,omitempty" json:"set,omitempty"`       // 设置参数，值支持模板
+
+	set map[string]*Template
+}
+
+// compile 校验并编译重写配置
+func (r *RewriteConfig) compile() error {
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("编译重写正则 %q 失败: %w", r.Regex, err)
+		}
+		r.re = re
+	}
+	if r.Template != "" {
+		template, err := ParseTemplate(r.Template)
+		if err != nil {
+			return err
+		}
+		r.template = template
+	}
+	if r.Query != nil {
+		r.Query.set = make(map[string]*Template, len(r.Query.Set))
+		for key, value := range r.Query.Set {
+			template, err := ParseTemplate(value)
+			if err != nil {
+				return fmt.Errorf("查询参数 %s: %w", key, err)
+			}
+			r.Query.set[key] = template
+		}
+	}
+	return nil
+}
+
+// RewritePath 重写路径，lookup 为模板变量的取值函数，返回未转义的原始值
+// 模板中的变量按所在位置转义（见 Template.RenderURI），客户端的值不能引入额外的路径段、查询参数或片段
+// 正则和模板在配置加载时编译，未经过 LoadConfig/SaveConfig 的配置会跳过这两步
+func (r *RewriteConfig) RewritePath(path string, lookup func(source, name string) string) string {
+	if r.StripPrefix != "" && strings.HasPrefix(path, r.StripPrefix) {
+		path = strings.TrimPrefix(path, r.StripPrefix)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+
+	if r.re != nil {
+		path = r.re.ReplaceAllString(path, r.Replacement)
+	}
+
+	if r.template != nil {
+		current := path
+		path = r.template.RenderURI(func(source, name string) string {
+			// {path} 为前面几步处理后的路径
+			if source == TemplateSourcePath && name == "" {
+				return current
+			}
+			return lookup(source, name)
+		})
+	}
+
+	if r.AddPrefix != "" {
+		path = strings.TrimSuffix(r.AddPrefix, "/") + path
+	}
+	return path
+}
+
+// SetTemplates 返回编译后的查询参数模板
+func (q *QueryRewrite) SetTemplates() map[string]*Template {
+	return q.set
+}
+
+// RewritePath 按旧的 rewrite_path 配置重写路径
+// prefix、segment、exact 方式把匹配的前缀替换为 rewrite_path；glob、regex 方式把 rewrite_path 作为正则替换结果，支持 $1、${name}
+func (m *MatchCondition) RewritePath(path, rewritePath string) string {
+	switch m.PathType {
+	case PathTypeGlob, PathTypeRegex:
+		matcher := m.pathMatcher
+		if matcher == nil {
+			var err error
+			if matcher, err = newPathMatcher(m.Path, m.PathType, m.PathNegate); err != nil {
+				return path
+			}
+		}
+		if matcher.re == nil || matcher.negate {
+			return path
+		}
+		return matcher.re.ReplaceAllString(path, rewritePath)
+	default:
+		if !strings.HasPrefix(path, m.Path) {
+			return path
+		}
+		return rewritePath + strings.TrimPrefix(path, m.Path)
+	}
+}
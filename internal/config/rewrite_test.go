@@ -0,0 +1,87 @@
+package config
+
+import "testing"
+
+// TestRewritePath 路径按 strip_prefix、regex、template、add_prefix 的顺序处理，模板中的变量按所在位置转义
+func TestRewritePath(t *testing.T) {
+	values := map[string]string{
+		"path.id":     "1",
+		"path.rest":   "a/b c",
+		"path.query":  "1?admin=true",
+		"path.hash":   "1#frag",
+		"header.X-Id": "../admin",
+		"query.q":     "a&admin=1",
+	}
+	lookup := func(source, name string) string {
+		return values[source+"."+name]
+	}
+
+	tests := []struct {
+		name    string
+		rewrite RewriteConfig
+		path    string
+		want    string
+	}{
+		{"去掉前缀", RewriteConfig{StripPrefix: "/api"}, "/api/users", "/users"},
+		{"去掉整个路径", RewriteConfig{StripPrefix: "/api"}, "/api", "/"},
+		{"添加前缀", RewriteConfig{AddPrefix: "/v2/"}, "/users", "/v2/users"},
+		{"正则替换", RewriteConfig{Regex: `^/users/(\d+)$`, Replacement: "/members/$1"}, "/users/7", "/members/7"},
+		{"命名捕获组", RewriteConfig{Regex: `^/(?P<name>\w+)/`, Replacement: "/${name}-v2/"}, "/users/7", "/users-v2/7"},
+		{"模板", RewriteConfig{Template: "/v2/users/{path.id}"}, "/users/1", "/v2/users/1"},
+		{"模板中的当前路径", RewriteConfig{StripPrefix: "/api", Template: "/v2{path}"}, "/api/users/1", "/v2/users/1"},
+		{"所有步骤", RewriteConfig{StripPrefix: "/api", Regex: "^/users", Replacement: "/members", Template: "{path}/{path.id}", AddPrefix: "/v2"}, "/api/users", "/v2/members/1"},
+		{"捕获中的 ?", RewriteConfig{Template: "/v2/users/{path.query}"}, "/users/1?admin=true", "/v2/users/1%3Fadmin=true"},
+		{"捕获中的 #", RewriteConfig{Template: "/v2/users/{path.hash}"}, "/users/1#frag", "/v2/users/1%23frag"},
+		{"多段捕获保留 /", RewriteConfig{Template: "/files/{path.rest}"}, "/static/a/b c", "/files/a/b%20c"},
+		{"请求头不能引入路径段", RewriteConfig{Template: "/users/{header.X-Id}"}, "/", "/users/..%2Fadmin"},
+		{"查询参数中的变量", RewriteConfig{Template: "/search?q={query.q}"}, "/", "/search?q=a%26admin%3D1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewrite := tt.rewrite
+			if err := rewrite.compile(); err != nil {
+				t.Fatal(err)
+			}
+			if got := rewrite.RewritePath(tt.path, lookup); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRewriteInvalid 无效的正则和模板在加载时报错
+func TestRewriteInvalid(t *testing.T) {
+	tests := []RewriteConfig{
+		{Regex: "(", Replacement: "/"},
+		{Template: "/users/{path.id"},
+		{Template: "/users/{unknown}"},
+		{Template: "/users/{header}"},
+		{Query: &QueryRewrite{Set: map[string]string{"id": "{query}"}}},
+	}
+	for _, rewrite := range tests {
+		if err := rewrite.compile(); err == nil {
+			t.Errorf("%+v: 期望编译失败", rewrite)
+		}
+	}
+}
+
+// TestLegacyRewritePath 旧的 rewrite_path 配置
+func TestLegacyRewritePath(t *testing.T) {
+	tests := []struct {
+		match       MatchCondition
+		rewritePath string
+		path        string
+		want        string
+	}{
+		{MatchCondition{Path: "/api"}, "/v2", "/api/users", "/v2/users"},
+		{MatchCondition{Path: "/api"}, "/v2", "/other", "/other"},
+		{MatchCondition{Path: "/users/{id}", PathType: PathTypeGlob}, "/members/${id}", "/users/7", "/members/7"},
+		{MatchCondition{Path: `^/users/(\d+)$`, PathType: PathTypeRegex}, "/members/$1", "/users/7", "/members/7"},
+		{MatchCondition{Path: `^/users/(\d+)$`, PathType: PathTypeRegex, PathNegate: true}, "/members/$1", "/other", "/other"},
+	}
+	for _, tt := range tests {
+		if got := tt.match.RewritePath(tt.path, tt.rewritePath); got != tt.want {
+			t.Errorf("%s %s: got %q, want %q", tt.match.Path, tt.path, got, tt.want)
+		}
+	}
+}
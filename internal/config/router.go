@@ -0,0 +1,139 @@
+package config
+
+import (
+	"slices"
+	"strings"
+)
+
+// RouteTable 编译后的路由表，配置加载时创建，创建后不再修改，多个请求可以同时读取
+// 规则按路径中的固定前缀索引在基数树中，查找时只返回路径可能匹配的规则，
+// 无法按前缀索引的规则（未配置路径、路径取反、正则）挂在根节点上，总是作为候选
+type RouteTable struct {
+	order []int            // 规则的匹配顺序（规则下标）
+	root  *routeNode       // 按固定前缀索引的规则
+	exact map[string][]int // exact 匹配方式的规则，按完整路径索引
+}
+
+// routeNode 基数树节点，边上的字符串压缩存储在子节点的 prefix 中
+type routeNode struct {
+	prefix   string
+	children []*routeNode
+	ranks    []int // 固定前缀恰好到这个节点为止的规则在匹配顺序中的位置
+}
+
+// newRouteTable 根据规则创建路由表
+func newRouteTable(rules []ProxyRule) *RouteTable {
+	t := &RouteTable{
+		order: ruleOrder(rules),
+		root:  &routeNode{},
+		exact: make(map[string][]int),
+	}
+	for rank, i := range t.order {
+		m := &rules[i].Match
+		if m.pathType() == PathTypeExact && !m.PathNegate && m.Path != "" {
+			t.exact[m.Path] = append(t.exact[m.Path], rank)
+			continue
+		}
+		t.root.insert(m.routePrefix(), rank)
+	}
+	return t
+}
+
+// routePrefix 能匹配该条件的请求路径一定以返回值开头，无法确定时返回空字符串
+func (m *MatchCondition) routePrefix() string {
+	if m.PathNegate {
+		return ""
+	}
+	switch m.pathType() {
+	case PathTypePrefix:
+		return m.Path
+	case PathTypeSegment:
+		if m.Path == "/" {
+			return m.Path
+		}
+		return strings.TrimSuffix(m.Path, "/")
+	case PathTypeGlob:
+		return globLiteralPrefix(m.Path)
+	default:
+		// 正则不会自动添加 ^，可以匹配路径的任意位置
+		return ""
+	}
+}
+
+// Candidates 返回路径可能匹配的规则下标，按匹配顺序排列
+// buf 用于复用切片，避免每个请求都分配内存
+func (t *RouteTable) Candidates(path string, buf []int) []int {
+	ranks := buf[:0]
+	ranks = t.root.collect(path, ranks)
+	ranks = append(ranks, t.exact[path]...)
+	slices.Sort(ranks)
+	for i, rank := range ranks {
+		ranks[i] = t.order[rank]
+	}
+	return ranks
+}
+
+// insert 添加固定前缀为 key 的规则
+func (n *routeNode) insert(key string, rank int) {
+	for {
+		if key == "" {
+			n.ranks = append(n.ranks, rank)
+			return
+		}
+
+		var child *routeNode
+		for _, c := range n.children {
+			if c.prefix[0] == key[0] {
+				child = c
+				break
+			}
+		}
+		if child == nil {
+			n.children = append(n.children, &routeNode{prefix: key, ranks: []int{rank}})
+			return
+		}
+
+		common := commonPrefixLength(key, child.prefix)
+		if common < len(child.prefix) {
+			// 拆分子节点，公共部分成为新的中间节点
+			split := &routeNode{prefix: child.prefix[:common], children: []*routeNode{child}}
+			child.prefix = child.prefix[common:]
+			for i, c := range n.children {
+				if c == child {
+					n.children[i] = split
+				}
+			}
+			child = split
+		}
+		n, key = child, key[common:]
+	}
+}
+
+// collect 收集固定前缀是 path 前缀的所有规则
+func (n *routeNode) collect(path string, ranks []int) []int {
+	for {
+		ranks = append(ranks, n.ranks...)
+		var next *routeNode
+		for _, c := range n.children {
+			if strings.HasPrefix(path, c.prefix) {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return ranks
+		}
+		n, path = next, path[len(next.prefix):]
+	}
+}
+
+// commonPrefixLength 两个字符串公共前缀的长度
+func commonPrefixLength(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
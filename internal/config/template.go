@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// 模板变量的来源
+const (
+	TemplateSourcePath   = "path"   // {path} 当前路径，{path.name} 路径匹配的命名捕获
+	TemplateSourceHeader = "header" // {header.Name} 请求头
+	TemplateSourceQuery  = "query"  // {query.name} 查询参数
+	TemplateSourceCookie = "cookie" // {cookie.name} Cookie
+	TemplateSourceMethod = "method" // {method} 请求方法
+
+	TemplateSourceClientIP  = "client_ip"  // {client_ip} 客户端 IP
+	TemplateSourceRequestID = "request_id" // {request_id} 请求 ID，与日志中的 request_id 相同
+	TemplateSourceEnv       = "env"        // {env.NAME} 环境变量
+	TemplateSourceCall      = "call"       // {call.名称.gjson路径} 聚合规则中其他子请求的响应体，只用于聚合规则
+)
+
+// Template 编译后的模板，由普通文本和 {来源.名称} 变量组成
+type Template struct {
+	raw   string
+	parts []templatePart
+}
+
+// templatePart 模板片段，source 为空时是普通文本
+type templatePart struct {
+	literal string
+	source  string
+	name    string
+}
+
+// ParseTemplate 解析模板，变量写作 {来源.名称}，{{ 和 }} 表示字面量的花括号
+func ParseTemplate(s string) (*Template, error) {
+	t := &Template{raw: s}
+	var literal strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"):
+			literal.WriteByte('{')
+			i += 2
+		case strings.HasPrefix(s[i:], "}}"):
+			literal.WriteByte('}')
+			i += 2
+		case s[i] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("模板 %q 中的 { 没有闭合", s)
+			}
+			source, name, _ := strings.Cut(s[i+1:i+end], ".")
+			source = strings.TrimSpace(source)
+			name = strings.TrimSpace(name)
+			if err := validateTemplateVar(source, name); err != nil {
+				return nil, fmt.Errorf("模板 %q 无效: %w", s, err)
+			}
+			if literal.Len() > 0 {
+				t.parts = append(t.parts, templatePart{literal: literal.String()})
+				literal.Reset()
+			}
+			t.parts = append(t.parts, templatePart{source: source, name: name})
+			i += end + 1
+		default:
+			literal.WriteByte(s[i])
+			i++
+		}
+	}
+	if literal.Len() > 0 {
+		t.parts = append(t.parts, templatePart{literal: literal.String()})
+	}
+	return t, nil
+}
+
+// validateTemplateVar 校验模板变量
+func validateTemplateVar(source, name string) error {
+	switch source {
+	case TemplateSourcePath, TemplateSourceMethod, TemplateSourceClientIP, TemplateSourceRequestID:
+		return nil
+	case TemplateSourceHeader, TemplateSourceQuery, TemplateSourceCookie, TemplateSourceEnv, TemplateSourceCall:
+		if name == "" {
+			return fmt.Errorf("变量 {%s} 需要指定名称，如 {%s.name}", source, source)
+		}
+		return nil
+	default:
+		return fmt.Errorf("未知的变量来源 %q（支持 path、header、query、cookie、method、client_ip、request_id、env、call）", source)
+	}
+}
+
+// Render 渲染模板，lookup 根据来源和名称返回变量值，不存在时返回空字符串
+func (t *Template) Render(lookup func(source, name string) string) string {
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.source == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+		b.WriteString(lookup(part.source, part.name))
+	}
+	return b.String()
+}
+
+// RenderURI 渲染路径和查询参数模板，变量的值按所在位置转义，避免引入额外的路径段、查询参数或片段：
+// ? 之前按路径段转义（{path} 和 {path.name} 保留其中的 /，只有 ** 或正则这类跨多段的捕获会带有 /），? 之后按查询参数转义
+func (t *Template) RenderURI(lookup func(source, name string) string) string {
+	var b strings.Builder
+	inQuery := false
+	for _, part := range t.parts {
+		if part.source == "" {
+			b.WriteString(part.literal)
+			inQuery = inQuery || strings.Contains(part.literal, "?")
+			continue
+		}
+		value := lookup(part.source, part.name)
+		switch {
+		case inQuery:
+			b.WriteString(url.QueryEscape(value))
+		case part.source == TemplateSourcePath:
+			segments := strings.Split(value, "/")
+			for i := range segments {
+				segments[i] = url.PathEscape(segments[i])
+			}
+			b.WriteString(strings.Join(segments, "/"))
+		default:
+			b.WriteString(url.PathEscape(value))
+		}
+	}
+	return b.String()
+}
+
+// Names 返回模板中指定来源的变量名称
+func (t *Template) Names(source string) []string {
+	var names []string
+	for _, part := range t.parts {
+		if part.source == source {
+			names = append(names, part.name)
+		}
+	}
+	return names
+}
+
+// String 返回模板原文
+func (t *Template) String() string {
+	return t.raw
+}
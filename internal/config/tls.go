@@ -0,0 +1,68 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// compile 读取并校验 CA 证书和客户端证书，生成连接上游使用的 tls.Config
+// 文件不存在或内容无效时配置不会生效，避免加载成功后所有请求都因为证书失败
+func (t *UpstreamTLSConfig) compile() error {
+	tlsConfig, err := t.load()
+	if err != nil {
+		return err
+	}
+	t.tlsConfig = tlsConfig
+	return nil
+}
+
+// load 读取证书文件，生成 tls.Config
+func (t *UpstreamTLSConfig) load() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书文件失败: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA 证书文件 %s 中没有有效的证书", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return nil, errors.New("客户端证书需要同时配置 cert_file 和 key_file")
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// ClientConfig 返回连接上游使用的 tls.Config，未配置时返回 nil，使用默认配置
+func (t *UpstreamTLSConfig) ClientConfig() (*tls.Config, error) {
+	if t == nil {
+		return nil, nil
+	}
+	if t.tlsConfig == nil {
+		// 没有经过 LoadConfig/SaveConfig 的配置，临时读取证书文件
+		return t.load()
+	}
+	return t.tlsConfig.Clone(), nil
+}
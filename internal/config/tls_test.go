@@ -0,0 +1,123 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert 生成自签名证书和私钥，返回文件路径
+func writeTestCert(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+"-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// TestUpstreamTLSCompile 证书文件在编译配置时读取，无效时返回错误
+func TestUpstreamTLSCompile(t *testing.T) {
+	dir := t.TempDir()
+	caFile, _ := writeTestCert(t, dir, "ca")
+	certFile, keyFile := writeTestCert(t, dir, "client")
+	_, otherKeyFile := writeTestCert(t, dir, "other")
+	badFile := filepath.Join(dir, "bad.pem")
+	if err := os.WriteFile(badFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  UpstreamTLSConfig
+		ok   bool
+	}{
+		{"只配置 SNI", UpstreamTLSConfig{ServerName: "api.internal"}, true},
+		{"CA 证书", UpstreamTLSConfig{CAFile: caFile}, true},
+		{"客户端证书", UpstreamTLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, true},
+		{"CA 文件不存在", UpstreamTLSConfig{CAFile: filepath.Join(dir, "missing.pem")}, false},
+		{"CA 文件不是 PEM", UpstreamTLSConfig{CAFile: badFile}, false},
+		{"只配置证书", UpstreamTLSConfig{CertFile: certFile}, false},
+		{"私钥文件不存在", UpstreamTLSConfig{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.pem")}, false},
+		{"证书和私钥不匹配", UpstreamTLSConfig{CertFile: certFile, KeyFile: otherKeyFile}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.compile()
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok = %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			tlsConfig, err := tt.cfg.ClientConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tlsConfig.ServerName != tt.cfg.ServerName {
+				t.Errorf("ServerName = %q, want %q", tlsConfig.ServerName, tt.cfg.ServerName)
+			}
+			if (tlsConfig.RootCAs != nil) != (tt.cfg.CAFile != "") {
+				t.Errorf("RootCAs = %v, want CA from %q", tlsConfig.RootCAs, tt.cfg.CAFile)
+			}
+			if len(tlsConfig.Certificates) > 0 != (tt.cfg.CertFile != "") {
+				t.Errorf("Certificates = %d, want client certificate from %q", len(tlsConfig.Certificates), tt.cfg.CertFile)
+			}
+		})
+	}
+}
+
+// TestLoadConfigRejectsInvalidTLS 上游 TLS 配置无效时加载配置失败
+func TestLoadConfigRejectsInvalidTLS(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	yaml := `proxy:
+  rules:
+    - name: tls
+      match:
+        path: /
+      target: https://127.0.0.1:8443
+      tls:
+        ca_file: ` + filepath.Join(dir, "missing.pem") + `
+`
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("CA 文件不存在时加载配置成功")
+	}
+}
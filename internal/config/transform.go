@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// 转换步骤的操作
+const (
+	TransformSet     = "set"     // 设置头部或查询参数，覆盖已有的值
+	TransformAdd     = "add"     // 追加头部或查询参数的值；添加 Cookie（请求中同名 Cookie 会被替换）
+	TransformRemove  = "remove"  // 删除头部、Cookie 或查询参数
+	TransformRename  = "rename"  // 重命名头部，保留所有值
+	TransformReplace = "replace" // 按正则替换头部的每个值
+	TransformRewrite = "rewrite" // 改写 Cookie 的名称、值和属性
+)
+
+// TransformConfig 请求和响应的头部、Cookie、查询参数转换，步骤按配置顺序执行
+// 请求步骤在 headers 配置之后执行，查询参数步骤在 rewrite 之后执行
+type TransformConfig struct {
+	Request      []TransformStep      `yaml:"request,omitempty" json:"request,omitempty"`             // 转发给上游之前执行的步骤
+	Response     []TransformStep      `yaml:"response,omitempty" json:"response,omitempty"`           // 返回给客户端之前执行的步骤（不支持查询参数）
+	RequestBody  *BodyTransformConfig `yaml:"request_body,omitempty" json:"request_body,omitempty"`   // 请求体转换，在转发之前执行
+	ResponseBody *BodyTransformConfig `yaml:"response_body,omitempty" json:"response_body,omitempty"` // JSON 响应体转换
+}
+
+// TransformStep 转换步骤，header、cookie、query 指定操作的对象，只能配置其中一个
+// 请求中的 Cookie 是 Cookie 请求头中的一项；响应中的 Cookie 是一条 Set-Cookie 响应头
+type TransformStep struct {
+	Action      string `yaml:"action" json:"action"`                               // set、add、remove、rename、replace、rewrite
+	Header      string `yaml:"header,omitempty" json:"header,omitempty"`           // 头部名称
+	Cookie      string `yaml:"cookie,omitempty" json:"cookie,omitempty"`           // Cookie 名称
+	Query       string `yaml:"query,omitempty" json:"query,omitempty"`             // 查询参数名称
+	Value       string `yaml:"value,omitempty" json:"value,omitempty"`             // set、add 的值，rewrite 的新 Cookie 值，支持模板
+	To          string `yaml:"to,omitempty" json:"to,omitempty"`                   // rename、rewrite 的新名称
+	Regex       string `yaml:"regex,omitempty" json:"regex,omitempty"`             // replace、rewrite 匹配值的正则
+	Replacement string `yaml:"replacement,omitempty" json:"replacement,omitempty"` // 正则替换结果，支持 $1、${name} 引用捕获组
+
+	// 响应 Cookie 的属性，用于 add 和 rewrite，未配置的属性保持不变
+	Domain   *string `yaml:"domain,omitempty" json:"domain,omitempty"`       // Domain，空字符串表示去掉
+	Path     *string `yaml:"path,omitempty" json:"path,omitempty"`           // Path，空字符串表示去掉
+	MaxAge   *int    `yaml:"max_age,omitempty" json:"max_age,omitempty"`     // Max-Age（秒），0 表示立即过期
+	Secure   *bool   `yaml:"secure,omitempty" json:"secure,omitempty"`       // Secure
+	HTTPOnly *bool   `yaml:"http_only,omitempty" json:"http_only,omitempty"` // HttpOnly
+	SameSite string  `yaml:"same_site,omitempty" json:"same_site,omitempty"` // SameSite：Lax、Strict、None
+
+	value *Template
+	re    *regexp.Regexp
+}
+
+// compile 校验并编译转换步骤
+func (t *TransformConfig) compile() error {
+	for i := range t.Request {
+		if err := t.Request[i].compile(false); err != nil {
+			return fmt.Errorf("request 第 %d 步: %w", i+1, err)
+		}
+	}
+	for i := range t.Response {
+		if err := t.Response[i].compile(true); err != nil {
+			return fmt.Errorf("response 第 %d 步: %w", i+1, err)
+		}
+	}
+	if t.RequestBody != nil {
+		if err := t.RequestBody.compile(false); err != nil {
+			return fmt.Errorf("request_body: %w", err)
+		}
+	}
+	if t.ResponseBody != nil {
+		if err := t.ResponseBody.compile(true); err != nil {
+			return fmt.Errorf("response_body: %w", err)
+		}
+	}
+	return nil
+}
+
+// compile 校验转换步骤，编译值模板和正则
+func (s *TransformStep) compile(response bool) error {
+	targets := 0
+	for _, name := range []string{s.Header, s.Cookie, s.Query} {
+		if name != "" {
+			targets++
+		}
+	}
+	if targets != 1 {
+		return fmt.Errorf("header、cookie、query 需要且只能配置一个")
+	}
+
+	var actions []string
+	switch {
+	case s.Header != "":
+		actions = []string{TransformSet, TransformAdd, TransformRemove, TransformRename, TransformReplace}
+	case s.Cookie != "":
+		actions = []string{TransformAdd, TransformRemove, TransformRewrite}
+	default:
+		if response {
+			return fmt.Errorf("响应不支持查询参数转换")
+		}
+		actions = []string{TransformSet, TransformAdd, TransformRemove}
+	}
+	if !slices.Contains(actions, s.Action) {
+		return fmt.Errorf("不支持的操作 %q（支持 %s）", s.Action, strings.Join(actions, "、"))
+	}
+
+	hasAttributes := s.Domain != nil || s.Path != nil || s.MaxAge != nil || s.Secure != nil || s.HTTPOnly != nil || s.SameSite != ""
+	if hasAttributes && (s.Cookie == "" || !response) {
+		return fmt.Errorf("domain、path、max_age、secure、http_only、same_site 只能用于响应的 Cookie")
+	}
+	switch s.SameSite {
+	case "", "Lax", "Strict", "None":
+	default:
+		return fmt.Errorf("未知的 same_site %q（支持 Lax、Strict、None）", s.SameSite)
+	}
+
+	switch s.Action {
+	case TransformRename:
+		if s.To == "" {
+			return fmt.Errorf("rename 需要配置 to")
+		}
+	case TransformReplace:
+		if s.Regex == "" {
+			return fmt.Errorf("replace 需要配置 regex")
+		}
+	case TransformRewrite:
+		if s.To == "" && s.Value == "" && s.Regex == "" && !hasAttributes {
+			return fmt.Errorf("rewrite 需要配置 to、value、regex 或 Cookie 属性")
+		}
+	}
+
+	if s.Value != "" {
+		template, err := ParseTemplate(s.Value)
+		if err != nil {
+			return err
+		}
+		s.value = template
+	}
+	if s.Regex != "" {
+		re, err := regexp.Compile(s.Regex)
+		if err != nil {
+			return fmt.Errorf("编译正则 %q 失败: %w", s.Regex, err)
+		}
+		s.re = re
+	}
+	return nil
+}
+
+// RenderValue 渲染 value 模板，lookup 为模板变量的取值函数
+func (s *TransformStep) RenderValue(lookup func(source, name string) string) string {
+	if s.value == nil {
+		// 没有经过 LoadConfig/SaveConfig 的配置，按原文使用
+		return s.Value
+	}
+	return s.value.Render(lookup)
+}
+
+// ReplaceValue 按 regex 和 replacement 替换值，未配置 regex 时原样返回
+func (s *TransformStep) ReplaceValue(value string) string {
+	re := s.re
+	if re == nil {
+		if s.Regex == "" {
+			return value
+		}
+		// 没有经过 LoadConfig/SaveConfig 的配置，临时编译
+		var err error
+		if re, err = regexp.Compile(s.Regex); err != nil {
+			return value
+		}
+	}
+	return re.ReplaceAllString(value, s.Replacement)
+}
@@ -0,0 +1,194 @@
+package listener
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// 自签名证书的保存路径，重启后继续使用同一张证书，浏览器信任一次即可
+const (
+	selfSignedCertFile = "certs/bff-proxy-selfsigned.crt"
+	selfSignedKeyFile  = "certs/bff-proxy-selfsigned.key"
+)
+
+// certCheckInterval 检查证书文件是否变化的最小间隔
+const certCheckInterval = 2 * time.Second
+
+// certReloader 在 TLS 握手时提供证书，证书文件修改后自动重新加载
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time // 证书和私钥文件中较新的修改时间
+	checkedAt time.Time // 最近一次检查文件的时间
+}
+
+// newCertReloader 加载证书并创建 certReloader
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load 读取证书文件（需要先获取锁或在初始化时调用）
+func (r *certReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("加载证书失败: %w", err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+	return nil
+}
+
+// latestModTime 返回证书和私钥文件中较新的修改时间
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("读取证书文件失败: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// GetCertificate 实现 tls.Config.GetCertificate
+// 证书文件变化时重新加载，加载失败时继续使用旧证书
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) < certCheckInterval {
+		return r.cert, nil
+	}
+	r.checkedAt = time.Now()
+
+	modTime, err := r.latestModTime()
+	if err != nil || !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+	if err := r.load(); err != nil {
+		hlog.Errorf("重新加载证书 %s 失败，继续使用旧证书: %v", r.certFile, err)
+		return r.cert, nil
+	}
+	hlog.Infof("证书 %s 已重新加载", r.certFile)
+	return r.cert, nil
+}
+
+// ensureSelfSigned 返回自签名证书文件路径，文件不存在、证书过期或缺少配置的主机时重新生成
+func ensureSelfSigned(hosts []string) (string, string, error) {
+	if cert, err := tls.LoadX509KeyPair(selfSignedCertFile, selfSignedKeyFile); err == nil {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && time.Now().Before(leaf.NotAfter) && coversHosts(leaf, hosts) {
+			return selfSignedCertFile, selfSignedKeyFile, nil
+		}
+	}
+
+	if err := generateSelfSigned(selfSignedCertFile, selfSignedKeyFile, hosts); err != nil {
+		return "", "", err
+	}
+	hlog.Infof("已生成自签名证书 %s，首次访问需要在浏览器中信任该证书", selfSignedCertFile)
+	return selfSignedCertFile, selfSignedKeyFile, nil
+}
+
+// coversHosts 判断证书是否包含所有配置的主机
+func coversHosts(leaf *x509.Certificate, hosts []string) bool {
+	for _, host := range hosts {
+		if leaf.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// generateSelfSigned 生成自签名证书，包含 localhost、本机 IP 和额外配置的主机
+func generateSelfSigned(certFile, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("生成私钥失败: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("生成证书序列号失败: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"BFF Proxy"}, CommonName: "BFF Proxy Dev"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	for _, host := range append([]string{"localhost"}, append(hosts, localIPs()...)...) {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("生成证书失败: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("序列化私钥失败: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0755); err != nil {
+		return fmt.Errorf("创建证书目录失败: %w", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("写入证书文件失败: %w", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("写入私钥文件失败: %w", err)
+	}
+	return nil
+}
+
+// localIPs 返回本机所有网卡的 IP，方便在局域网内用 IP 访问
+func localIPs() []string {
+	ips := []string{"127.0.0.1", "::1"}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ips
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			ips = append(ips, ipNet.IP.String())
+		}
+	}
+	return ips
+}
@@ -0,0 +1,152 @@
+package listener
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// Listener 使用 net/http 的监听（HTTPS、h2c）
+// 请求转发到本机的 HTTP 监听端口处理，转发时添加 X-Forwarded-For、X-Forwarded-Host 和 X-Forwarded-Proto；
+// gRPC 请求需要 HTTP/2 的 trailer，由 grpc 处理器直接转发到上游
+type Listener struct {
+	server *http.Server
+	port   int
+	tls    bool
+}
+
+// NewTLSListener 根据配置创建 HTTPS 监听（通过 ALPN 支持 HTTP/2）
+// backendPort 为处理请求的 HTTP 监听端口，grpc 为处理 gRPC 请求的处理器
+func NewTLSListener(cfg config.ListenerConfig, backendPort int, grpc http.Handler) (*Listener, error) {
+	certFile, keyFile := cfg.TLS.CertFile, cfg.TLS.KeyFile
+	if certFile == "" && keyFile == "" {
+		if !cfg.TLS.SelfSigned {
+			return nil, fmt.Errorf("端口 %d 的 HTTPS 监听需要配置 cert_file 和 key_file，或者开启 self_signed", cfg.Port)
+		}
+		var err error
+		certFile, keyFile, err = ensureSelfSigned(cfg.TLS.Hosts)
+		if err != nil {
+			return nil, fmt.Errorf("生成自签名证书失败: %w", err)
+		}
+	}
+
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           newHandler(backendPort, grpc),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	if cfg.DisableHTTP2 {
+		// TLSNextProto 为非 nil 的空 map 时不会协商 HTTP/2
+		server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+
+	return &Listener{server: server, port: cfg.Port, tls: true}, nil
+}
+
+// NewH2CListener 根据配置创建明文 HTTP 监听，同时支持 HTTP/1.1 和 h2c（不加密的 HTTP/2），用于接收 gRPC 请求
+func NewH2CListener(cfg config.ListenerConfig, backendPort int, grpc http.Handler) *Listener {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           newHandler(backendPort, grpc),
+		Protocols:         protocols,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	return &Listener{server: server, port: cfg.Port}
+}
+
+// newHandler 创建请求处理器：gRPC 请求交给 grpc 处理器，其余请求转发到 backendPort
+func newHandler(backendPort int, grpc http.Handler) http.Handler {
+	backend := &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", backendPort)}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(backend)
+			r.Out.Host = r.In.Host
+			// 保留客户端请求中已有的转发链，由 HTTP 监听按受信任的代理判断是否采用
+			for _, key := range []string{"X-Forwarded-For", "Forwarded"} {
+				if values := r.In.Header[key]; len(values) > 0 {
+					r.Out.Header[key] = values
+				}
+			}
+			r.SetXForwarded()
+			// 标记这一跳来自内置监听，客户端带来的同名请求头被覆盖
+			r.Out.Header.Set(config.InternalHopHeader, config.InternalHopToken())
+		},
+		// 立即刷新响应，保证 SSE 等流式响应不被缓冲
+		FlushInterval: -1,
+		Transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
+			MaxIdleConnsPerHost: 256,
+			IdleConnTimeout:     90 * time.Second,
+			// 保留客户端的 Accept-Encoding，由上游决定是否压缩
+			DisableCompression: true,
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			hlog.Errorf("监听转发请求失败: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	if grpc == nil {
+		return proxy
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPCRequest(r) {
+			grpc.ServeHTTP(w, r)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// isGRPCRequest 判断是否是 gRPC 请求（HTTP/2，Content-Type 为 application/grpc，不包括 gRPC-Web）
+func isGRPCRequest(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	return r.ProtoMajor == 2 && (contentType == "application/grpc" ||
+		strings.HasPrefix(contentType, "application/grpc+") || strings.HasPrefix(contentType, "application/grpc;"))
+}
+
+// Start 在后台开始监听
+func (l *Listener) Start() {
+	go func() {
+		var err error
+		if l.tls {
+			hlog.Infof("HTTPS 监听启动在端口 %d", l.port)
+			err = l.server.ListenAndServeTLS("", "")
+		} else {
+			hlog.Infof("h2c 监听启动在端口 %d", l.port)
+			err = l.server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			hlog.Errorf("监听端口 %d 失败: %v", l.port, err)
+		}
+	}()
+}
+
+// Shutdown 优雅关闭
+func (l *Listener) Shutdown(ctx context.Context) error {
+	return l.server.Shutdown(ctx)
+}
@@ -22,19 +22,51 @@ var (
 
 // RequestLog 请求日志
 type RequestLog struct {
-	StartTime    time.Time         `json:"start_time"`
-	EndTime      time.Time         `json:"end_time"`
-	Duration     time.Duration     `json:"duration"`
-	Method       string            `json:"method"`
-	Path         string            `json:"path"`
-	Query        string            `json:"query"`
-	Headers      map[string]string `json:"headers"`
-	Body         string            `json:"body"`
-	StatusCode   int               `json:"status_code"`
-	ResponseBody string            `json:"response_body"`
-	Target       string            `json:"target"`
-	RuleName     string            `json:"rule_name"`
-	Error        string            `json:"error,omitempty"`
+	RequestID        string            `json:"request_id,omitempty"` // 请求 ID，调试模式下通过 X-BFF-Request-Id 响应头返回
+	StartTime        time.Time         `json:"start_time"`
+	EndTime          time.Time         `json:"end_time"`
+	Duration         time.Duration     `json:"duration"`
+	ClientIP         string            `json:"client_ip,omitempty"` // 客户端 IP，按受信任的代理解析转发链
+	Method           string            `json:"method"`
+	Path             string            `json:"path"`
+	Query            string            `json:"query"`
+	Headers          map[string]string `json:"headers"`
+	Body             string            `json:"body"`
+	StatusCode       int               `json:"status_code"`
+	ResponseBody     string            `json:"response_body"`
+	Target           string            `json:"target"`
+	RuleName         string            `json:"rule_name"`
+	PathParams       map[string]string `json:"path_params,omitempty"`       // 路径匹配的命名捕获
+	UpstreamURI      string            `json:"upstream_uri,omitempty"`      // 重写后转发给上游的路径和查询参数，未重写时为空
+	GraphQLOperation string            `json:"graphql_operation,omitempty"` // GraphQL 操作，如 query GetUser
+	GRPCStatus       string            `json:"grpc_status,omitempty"`       // gRPC 请求的 grpc-status
+	Error            string            `json:"error,omitempty"`
+	WebSocket        *WebSocketLog     `json:"websocket,omitempty"`
+	Attempts         []AttemptLog      `json:"attempts,omitempty"` // 配置了重试策略时记录每次尝试
+	Call             string            `json:"call,omitempty"`     // 聚合规则子请求的名称（只用于子请求日志）
+	Calls            []*RequestLog     `json:"calls,omitempty"`    // 聚合规则的子请求日志
+}
+
+// AttemptLog 单次转发尝试日志
+type AttemptLog struct {
+	Attempt    int           `json:"attempt"`           // 第几次尝试（从 1 开始）
+	Target     string        `json:"target"`            // 本次尝试的上游目标
+	StartTime  time.Time     `json:"start_time"`        // 开始时间
+	Duration   time.Duration `json:"duration"`          // 收到响应头或出错的耗时
+	StatusCode int           `json:"status_code"`       // 上游状态码，出错时为 0
+	Error      string        `json:"error,omitempty"`   // 错误信息
+	Backoff    time.Duration `json:"backoff,omitempty"` // 重试前的退避时间，最后一次尝试为 0
+}
+
+// WebSocketLog WebSocket 连接日志
+type WebSocketLog struct {
+	OpenTime       time.Time `json:"open_time"`       // 握手完成时间
+	CloseTime      time.Time `json:"close_time"`      // 连接关闭时间
+	ClosedBy       string    `json:"closed_by"`       // 先关闭连接的一方：client / upstream
+	ClientFrames   int64     `json:"client_frames"`   // 客户端发送的帧数
+	ClientBytes    int64     `json:"client_bytes"`    // 客户端发送的字节数
+	UpstreamFrames int64     `json:"upstream_frames"` // 上游发送的帧数
+	UpstreamBytes  int64     `json:"upstream_bytes"`  // 上游发送的字节数
 }
 
 // InitLogger 初始化日志
@@ -49,6 +81,7 @@ func InitLogger() {
 				MaxSize:    100,
 				MaxBackups: 10,
 				MaxAge:     30,
+				MaxBodySize: 10240,
 			},
 		}
 	}
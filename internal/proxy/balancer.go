@@ -0,0 +1,287 @@
+package proxy
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// errNoAvailableTarget 没有可用的上游目标
+var errNoAvailableTarget = errors.New("没有可用的上游目标")
+
+// balancer 负载均衡器
+// 轮询计数按规则名保存；活跃请求数和运行时摘除状态按目标地址保存，多个规则共享
+type balancer struct {
+	mu       sync.Mutex
+	counters map[string]*uint64 // 规则名 -> 轮询计数
+	active   map[string]*int64  // 目标地址 -> 活跃请求数
+	drained  map[string]bool    // 通过管理接口摘除的目标地址
+
+	healthy func(rule *config.ProxyRule, target string) bool                // 不健康或已熔断的目标不参与分配
+	reserve func(rule *config.ProxyRule, target string) (func(), int, bool) // 选中目标时占用熔断器的探测名额，返回释放名额的函数和探测轮次
+}
+
+// UpstreamStatus 上游目标状态（用于管理接口）
+type UpstreamStatus struct {
+	Rule     string `json:"rule"`
+	URL      string `json:"url"`
+	Weight   int    `json:"weight"`
+	Drain    bool   `json:"drain"`   // 配置中摘除
+	Drained  bool   `json:"drained"` // 运行时摘除
+	Active   int64  `json:"active"`  // 活跃请求数
+	Strategy string `json:"strategy"`
+}
+
+// newBalancer 创建负载均衡器
+func newBalancer(healthy func(rule *config.ProxyRule, target string) bool, reserve func(rule *config.ProxyRule, target string) (func(), int, bool)) *balancer {
+	return &balancer{
+		counters: make(map[string]*uint64),
+		active:   make(map[string]*int64),
+		drained:  make(map[string]bool),
+		healthy:  healthy,
+		reserve:  reserve,
+	}
+}
+
+// pick 为请求选择一个上游目标，并通过 acquire 占用熔断器的探测名额、记录活跃请求
+// 返回的 done 在请求结束时调用（包括选中后没有发出请求的情况），probe 在记录熔断器结果时使用
+func (b *balancer) pick(c *app.RequestContext, rule *config.ProxyRule) (string, func(), int, error) {
+	candidates := b.candidates(rule)
+	if len(candidates) == 0 {
+		return "", nil, 0, errNoAvailableTarget
+	}
+
+	// 跳过不健康或已熔断的目标
+	healthy := candidates[:0:0]
+	for _, target := range candidates {
+		if b.healthy(rule, target.URL) {
+			healthy = append(healthy, target)
+		}
+	}
+	candidates = healthy
+
+	for len(candidates) > 0 {
+		target := b.choose(c, rule, candidates)
+		if done, probe, ok := b.acquire(rule, target); ok {
+			return target, done, probe, nil
+		}
+		// 半开状态的探测名额被并发的请求占满，换一个目标
+		candidates = slices.DeleteFunc(candidates, func(t config.UpstreamTarget) bool {
+			return t.URL == target
+		})
+	}
+	return "", nil, 0, errNoHealthyTarget
+}
+
+// choose 按负载均衡策略从候选目标中选择一个
+func (b *balancer) choose(c *app.RequestContext, rule *config.ProxyRule, candidates []config.UpstreamTarget) string {
+	if len(candidates) == 1 {
+		return candidates[0].URL
+	}
+
+	switch rule.LoadBalance.Strategy {
+	case config.LoadBalanceWeightedRandom:
+		return pickWeighted(candidates, rand.Intn(totalWeight(candidates)))
+	case config.LoadBalanceLeastConn:
+		return b.pickLeastConn(candidates)
+	case config.LoadBalanceConsistentHash:
+		if key := hashKeyValue(c, rule.LoadBalance.HashKey); key != "" {
+			return pickRendezvous(candidates, key)
+		}
+		// 没有哈希键时退化为轮询
+	}
+
+	n := atomic.AddUint64(b.counter(rule.Name), 1) - 1
+	return pickWeighted(candidates, int(n%uint64(totalWeight(candidates))))
+}
+
+// candidates 返回可以分配请求的目标（排除摘除的目标），权重未配置时视为 1
+func (b *balancer) candidates(rule *config.ProxyRule) []config.UpstreamTarget {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	targets := rule.UpstreamTargets()
+	candidates := make([]config.UpstreamTarget, 0, len(targets))
+	for _, target := range targets {
+		if target.Drain || b.drained[target.URL] {
+			continue
+		}
+		if target.Weight <= 0 {
+			target.Weight = 1
+		}
+		candidates = append(candidates, target)
+	}
+	return candidates
+}
+
+// counter 返回规则的轮询计数器
+func (b *balancer) counter(ruleName string) *uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	counter, ok := b.counters[ruleName]
+	if !ok {
+		counter = new(uint64)
+		b.counters[ruleName] = counter
+	}
+	return counter
+}
+
+// activeCounter 返回目标的活跃请求计数器
+func (b *balancer) activeCounter(target string) *int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	counter, ok := b.active[target]
+	if !ok {
+		counter = new(int64)
+		b.active[target] = counter
+	}
+	return counter
+}
+
+// acquire 占用目标的熔断器探测名额（熔断中或名额已满时返回 false）并记录活跃请求，
+// 返回的函数在请求结束时调用，释放探测名额并减少活跃请求数；probe 为熔断器的探测轮次，没有占用探测名额时为 0
+func (b *balancer) acquire(rule *config.ProxyRule, target string) (func(), int, bool) {
+	release, probe, ok := b.reserve(rule, target)
+	if !ok {
+		return nil, 0, false
+	}
+	counter := b.activeCounter(target)
+	atomic.AddInt64(counter, 1)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(counter, -1)
+			release()
+		})
+	}, probe, true
+}
+
+// pickLeastConn 选择活跃请求数与权重之比最小的目标
+func (b *balancer) pickLeastConn(candidates []config.UpstreamTarget) string {
+	best := ""
+	bestScore := math.MaxFloat64
+	for _, target := range candidates {
+		score := float64(atomic.LoadInt64(b.activeCounter(target.URL))) / float64(target.Weight)
+		if score < bestScore {
+			best, bestScore = target.URL, score
+		}
+	}
+	return best
+}
+
+// setDrained 设置目标的运行时摘除状态
+func (b *balancer) setDrained(target string, drained bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if drained {
+		b.drained[target] = true
+	} else {
+		delete(b.drained, target)
+	}
+}
+
+// isDrained 判断目标是否通过管理接口摘除
+func (b *balancer) isDrained(target string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.drained[target]
+}
+
+// status 返回所有规则的上游目标状态
+func (b *balancer) status(cfg *config.Config) []UpstreamStatus {
+	statuses := make([]UpstreamStatus, 0)
+	for i := range cfg.Proxy.Rules {
+		rule := &cfg.Proxy.Rules[i]
+		strategy := rule.LoadBalance.Strategy
+		if strategy == "" {
+			strategy = config.LoadBalanceRoundRobin
+		}
+		for _, target := range rule.UpstreamTargets() {
+			weight := target.Weight
+			if weight <= 0 {
+				weight = 1
+			}
+			b.mu.Lock()
+			drained := b.drained[target.URL]
+			b.mu.Unlock()
+			statuses = append(statuses, UpstreamStatus{
+				Rule:     rule.Name,
+				URL:      target.URL,
+				Weight:   weight,
+				Drain:    target.Drain,
+				Drained:  drained,
+				Active:   atomic.LoadInt64(b.activeCounter(target.URL)),
+				Strategy: strategy,
+			})
+		}
+	}
+	return statuses
+}
+
+// totalWeight 计算总权重
+func totalWeight(targets []config.UpstreamTarget) int {
+	total := 0
+	for _, target := range targets {
+		total += target.Weight
+	}
+	return total
+}
+
+// pickWeighted 按权重区间选择目标，n 的取值范围为 [0, totalWeight)
+func pickWeighted(targets []config.UpstreamTarget, n int) string {
+	for _, target := range targets {
+		if n < target.Weight {
+			return target.URL
+		}
+		n -= target.Weight
+	}
+	return targets[len(targets)-1].URL
+}
+
+// pickRendezvous 使用加权 rendezvous 哈希选择目标
+// 与哈希环一样，增删目标时只有少量键会迁移到其他目标
+func pickRendezvous(targets []config.UpstreamTarget, key string) string {
+	best := ""
+	bestScore := math.Inf(-1)
+	for _, target := range targets {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(target.URL))
+		// 把哈希值映射到 (0, 1)，按权重计算得分
+		u := (float64(h.Sum64()>>11) + 0.5) / float64(uint64(1)<<53)
+		score := -float64(target.Weight) / math.Log(u)
+		if score > bestScore {
+			best, bestScore = target.URL, score
+		}
+	}
+	return best
+}
+
+// hashKeyValue 根据哈希键配置（header:名称 或 cookie:名称）读取请求中的值
+func hashKeyValue(c *app.RequestContext, hashKey string) string {
+	source, name, ok := strings.Cut(hashKey, ":")
+	if !ok {
+		// 未指定来源时按 Header 处理
+		source, name = "header", hashKey
+	}
+	switch strings.ToLower(strings.TrimSpace(source)) {
+	case "cookie":
+		return string(c.Cookie(strings.TrimSpace(name)))
+	default:
+		return string(c.GetHeader(strings.TrimSpace(name)))
+	}
+}
@@ -0,0 +1,280 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/tidwall/gjson"
+)
+
+// maxPeekBodySize Body 匹配时最多预读的请求体大小（1MB），超出部分不参与匹配
+const maxPeekBodySize = 1 << 20
+
+// 请求体类型，决定 Body 匹配使用的解析方式
+const (
+	bodyKindJSON = "json"
+	bodyKindForm = "form"
+	bodyKindXML  = "xml"
+)
+
+// requestBody 流式请求体
+// 只有在 Body 匹配需要时才预读前缀，预读的内容会在转发时重新拼接到流的开头
+type requestBody struct {
+	stream        io.Reader
+	contentLength int // 请求头中的 Content-Length，-1 表示 chunked
+	peeked        []byte
+	peekedAll     bool // 是否已经读取了完整的请求体
+	didPeek       bool
+	contentType   string // 请求头中的 Content-Type，决定 Body 匹配的解析方式
+
+	// 解析后的请求体，每个请求只解析一次，多条规则和条件共用
+	kind     string
+	json     gjson.Result
+	form     map[string][]string
+	xml      *xmlNode
+	didParse bool
+
+	query           *protocol.Args // 查询参数，GET 方式的 GraphQL 请求使用
+	graphql         *graphqlOperation
+	didParseGraphQL bool
+}
+
+// newRequestBody 从请求上下文创建流式请求体
+func newRequestBody(c *app.RequestContext) *requestBody {
+	return &requestBody{
+		stream:        c.RequestBodyStream(),
+		contentLength: c.Request.Header.ContentLength(),
+		contentType:   string(c.Request.Header.ContentType()),
+		query:         c.QueryArgs(),
+	}
+}
+
+// Peek 预读请求体前缀（最多 maxPeekBodySize 字节）
+func (b *requestBody) Peek() []byte {
+	if b.didPeek {
+		return b.peeked
+	}
+	b.didPeek = true
+
+	data, err := io.ReadAll(io.LimitReader(b.stream, maxPeekBodySize+1))
+	b.peeked = data
+	if err == nil && len(data) <= maxPeekBodySize {
+		b.peekedAll = true
+	}
+	if len(b.peeked) > maxPeekBodySize {
+		b.peeked = b.peeked[:maxPeekBodySize]
+		b.stream = io.MultiReader(bytes.NewReader(data[maxPeekBodySize:]), b.stream)
+	}
+	return b.peeked
+}
+
+// ReadAll 读取完整的请求体，超过 limit 字节时返回 errBodyTooLarge，已读取的部分仍会在转发时拼接到流的开头
+func (b *requestBody) ReadAll(limit int) ([]byte, error) {
+	b.Peek()
+	if b.peekedAll {
+		return b.peeked, nil
+	}
+
+	rest, err := io.ReadAll(io.LimitReader(b.stream, int64(limit-len(b.peeked)+1)))
+	if err != nil || len(b.peeked)+len(rest) > limit {
+		b.stream = io.MultiReader(bytes.NewReader(rest), b.stream)
+		if err != nil {
+			return nil, fmt.Errorf("读取请求体失败: %w", err)
+		}
+		return nil, fmt.Errorf("请求体%w（%d 字节）", errBodyTooLarge, limit)
+	}
+	b.peeked = slices.Concat(b.peeked, rest)
+	b.peekedAll = true
+	return b.peeked, nil
+}
+
+// SetBody 替换转发的请求体，ContentLength 随之变为新请求体的长度
+func (b *requestBody) SetBody(data []byte) {
+	b.didPeek = true
+	b.peeked = data
+	b.peekedAll = true
+}
+
+// parse 按 Content-Type 解析预读的请求体
+// 未声明或无法识别的类型按 JSON 处理；声明为 x-www-form-urlencoded 但内容是 JSON 时（如 curl -d 发送 JSON）也按 JSON 处理
+func (b *requestBody) parse() {
+	if b.didParse {
+		return
+	}
+	b.didParse = true
+
+	mediaType, params, _ := mime.ParseMediaType(b.contentType)
+	data := b.Peek()
+	switch {
+	case mediaType == "multipart/form-data":
+		b.kind = bodyKindForm
+		b.form = parseMultipartFields(data, params["boundary"])
+	case mediaType == "application/x-www-form-urlencoded" && !looksLikeJSON(data):
+		b.kind = bodyKindForm
+		if values, err := url.ParseQuery(string(data)); err == nil {
+			b.form = values
+		}
+	case mediaType == "application/xml", mediaType == "text/xml", strings.HasSuffix(mediaType, "+xml"):
+		b.kind = bodyKindXML
+		b.xml = parseXML(data)
+	default:
+		b.kind = bodyKindJSON
+		if gjson.ValidBytes(data) {
+			b.json = gjson.ParseBytes(data)
+		}
+	}
+}
+
+// looksLikeJSON 判断内容是否是 JSON 对象或数组
+func looksLikeJSON(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && gjson.ValidBytes(trimmed)
+}
+
+// Kind 返回请求体类型：json、form、xml
+func (b *requestBody) Kind() string {
+	b.parse()
+	return b.kind
+}
+
+// JSON 返回解析后的 JSON 请求体，请求体不是合法的 JSON 时返回空结果
+func (b *requestBody) JSON() gjson.Result {
+	b.parse()
+	return b.json
+}
+
+// Form 返回表单字段（x-www-form-urlencoded 或 multipart/form-data），其他类型返回 nil
+func (b *requestBody) Form() map[string][]string {
+	b.parse()
+	return b.form
+}
+
+// XML 返回解析后的 XML 文档，其他类型或解析失败时返回 nil
+func (b *requestBody) XML() *xmlNode {
+	b.parse()
+	return b.xml
+}
+
+// GraphQL 返回解析后的 GraphQL 操作，不是 GraphQL 请求或解析失败时返回 nil
+func (b *requestBody) GraphQL() *graphqlOperation {
+	if b.didParseGraphQL {
+		return b.graphql
+	}
+	b.didParseGraphQL = true
+
+	if op, ok := parseGraphQLRequest(b); ok {
+		b.graphql = op
+	}
+	return b.graphql
+}
+
+// parsedGraphQL 返回匹配过程中已经解析出的 GraphQL 操作，没有解析过时不会触发解析
+func (b *requestBody) parsedGraphQL() *graphqlOperation {
+	return b.graphql
+}
+
+// Reader 返回用于转发的请求体读取器（包含已预读的部分）
+func (b *requestBody) Reader() io.Reader {
+	if len(b.peeked) == 0 {
+		return b.stream
+	}
+	if b.peekedAll {
+		return bytes.NewReader(b.peeked)
+	}
+	return io.MultiReader(bytes.NewReader(b.peeked), b.stream)
+}
+
+// ContentLength 返回转发时使用的请求体长度，-1 表示未知（chunked）
+func (b *requestBody) ContentLength() int64 {
+	if b.peekedAll {
+		return int64(len(b.peeked))
+	}
+	if b.contentLength < 0 {
+		return -1
+	}
+	return int64(b.contentLength)
+}
+
+// bodyCapture 记录 body 的前 limit 个字节，用于日志记录
+type bodyCapture struct {
+	mu    sync.Mutex
+	buf   []byte
+	limit int
+	total int64
+}
+
+// newBodyCapture 创建 body 记录器
+func newBodyCapture(limit int) *bodyCapture {
+	return &bodyCapture{limit: limit}
+}
+
+// Write 实现 io.Writer，超出 limit 的部分只计数不保存
+func (b *bodyCapture) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.total += int64(len(p))
+	if room := b.limit - len(b.buf); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.buf = append(b.buf, p[:room]...)
+	}
+	return len(p), nil
+}
+
+// Format 格式化记录的内容，二进制内容只记录大小
+func (b *bodyCapture) Format(contentType string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.total == 0 {
+		return ""
+	}
+	if !isTextContentType(contentType) {
+		return fmt.Sprintf("[Binary Body: %d bytes]", b.total)
+	}
+	if b.total > int64(len(b.buf)) {
+		return fmt.Sprintf("%s...[truncated, %d bytes total]", b.buf, b.total)
+	}
+	return string(b.buf)
+}
+
+// loggingBody 包装上游响应体：边读边返回给客户端，同时记录前缀
+// 响应体传输结束（Close）时调用 onClose 完成日志记录
+type loggingBody struct {
+	body    io.ReadCloser
+	capture *bodyCapture
+	readErr error
+	once    sync.Once
+	onClose func(capture *bodyCapture, err error)
+}
+
+// Read 实现 io.Reader
+func (b *loggingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		b.capture.Write(p[:n])
+	}
+	if err != nil && err != io.EOF {
+		b.readErr = err
+	}
+	return n, err
+}
+
+// Close 实现 io.Closer，Hertz 在响应体写完（或连接中断）后调用
+func (b *loggingBody) Close() error {
+	err := b.body.Close()
+	b.once.Do(func() {
+		b.onClose(b.capture, b.readErr)
+	})
+	return err
+}
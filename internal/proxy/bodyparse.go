@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"mime/multipart"
+	"strconv"
+	"strings"
+)
+
+// maxMultipartFieldSize multipart 普通字段最多读取的长度，超出部分不参与匹配
+const maxMultipartFieldSize = 64 << 10
+
+// parseMultipartFields 解析 multipart 表单字段
+// 普通字段记录字段值，文件字段只记录文件名，不读取文件内容
+// 请求体被截断时返回已经解析出的字段
+func parseMultipartFields(data []byte, boundary string) map[string][]string {
+	if boundary == "" {
+		return nil
+	}
+	fields := make(map[string][]string)
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+		if part.FileName() != "" {
+			fields[name] = append(fields[name], part.FileName())
+			continue
+		}
+		value, err := io.ReadAll(io.LimitReader(part, maxMultipartFieldSize))
+		if err != nil {
+			break
+		}
+		fields[name] = append(fields[name], string(value))
+	}
+	return fields
+}
+
+// xmlNode XML 元素
+type xmlNode struct {
+	name     string // 本地名称，不含命名空间前缀
+	attrs    map[string]string
+	text     string // 直接包含的文本（去掉首尾空白）
+	children []*xmlNode
+}
+
+// parseXML 解析 XML 文档，返回包含根元素的文档节点，解析失败时返回 nil
+func parseXML(data []byte) *xmlNode {
+	doc := &xmlNode{}
+	stack := []*xmlNode{doc}
+	texts := []*strings.Builder{{}}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: make(map[string]string, len(t.Attr))}
+			for _, attr := range t.Attr {
+				node.attrs[attr.Name.Local] = attr.Value
+			}
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+			texts = append(texts, &strings.Builder{})
+		case xml.EndElement:
+			node := stack[len(stack)-1]
+			node.text = strings.TrimSpace(texts[len(texts)-1].String())
+			stack = stack[:len(stack)-1]
+			texts = texts[:len(texts)-1]
+		case xml.CharData:
+			texts[len(texts)-1].Write(t)
+		}
+	}
+	if len(doc.children) == 0 {
+		return nil
+	}
+	return doc
+}
+
+// xmlStep 选择器中的一步
+type xmlStep struct {
+	name       string // 元素名，* 表示任意元素
+	index      int    // [n] 按位置选择（从 1 开始），0 表示不限制
+	descendant bool   // 前面是 //，匹配任意层级的后代
+}
+
+// Select 按类 XPath 选择器取值，返回所有匹配的值
+// 支持 /order/id、order/id（相对文档根）、//sku（任意层级）、item[2]、*、@attr 和 text()
+func (n *xmlNode) Select(selector string) []string {
+	steps, attr, ok := parseXMLSelector(selector)
+	if !ok {
+		return nil
+	}
+
+	nodes := []*xmlNode{n}
+	for _, step := range steps {
+		var next []*xmlNode
+		for _, node := range nodes {
+			next = append(next, node.selectStep(step)...)
+		}
+		nodes = next
+		if len(nodes) == 0 {
+			return nil
+		}
+	}
+
+	values := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if attr == "" {
+			values = append(values, node.text)
+		} else if value, ok := node.attrs[attr]; ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// selectStep 在当前节点下选择满足一步条件的元素
+func (n *xmlNode) selectStep(step xmlStep) []*xmlNode {
+	var candidates []*xmlNode
+	if step.descendant {
+		n.walk(func(node *xmlNode) {
+			candidates = append(candidates, node)
+		})
+	} else {
+		candidates = n.children
+	}
+
+	var matched []*xmlNode
+	for _, node := range candidates {
+		if step.name == "*" || node.name == step.name {
+			matched = append(matched, node)
+		}
+	}
+	if step.index > 0 {
+		if step.index > len(matched) {
+			return nil
+		}
+		return matched[step.index-1 : step.index]
+	}
+	return matched
+}
+
+// walk 按文档顺序遍历所有后代元素
+func (n *xmlNode) walk(fn func(node *xmlNode)) {
+	for _, child := range n.children {
+		fn(child)
+		child.walk(fn)
+	}
+}
+
+// parseXMLSelector 解析选择器，返回元素步骤和最后的属性名
+func parseXMLSelector(selector string) ([]xmlStep, string, bool) {
+	var steps []xmlStep
+	var attr string
+	descendant := false
+
+	segments := strings.Split(strings.TrimPrefix(selector, "/"), "/")
+	for i, segment := range segments {
+		if segment == "" {
+			// 连续的 // 表示下一步匹配任意层级
+			descendant = true
+			continue
+		}
+		last := i == len(segments)-1
+		switch {
+		case strings.HasPrefix(segment, "@"):
+			if !last {
+				return nil, "", false
+			}
+			attr = segment[1:]
+			continue
+		case segment == "text()":
+			if !last {
+				return nil, "", false
+			}
+			continue
+		}
+
+		step := xmlStep{name: segment, descendant: descendant}
+		descendant = false
+		if open := strings.IndexByte(segment, '['); open > 0 && strings.HasSuffix(segment, "]") {
+			index, err := strconv.Atoi(segment[open+1 : len(segment)-1])
+			if err != nil || index < 1 {
+				return nil, "", false
+			}
+			step.name = segment[:open]
+			step.index = index
+		}
+		steps = append(steps, step)
+	}
+	return steps, attr, true
+}
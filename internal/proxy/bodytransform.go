@@ -0,0 +1,818 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/tidwall/gjson"
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// maxTransformBodySize 请求体和响应体转换最多读取的大小（10MB）
+const maxTransformBodySize = 10 << 20
+
+// errBodyTooLarge 需要转换的请求体或响应体超过 maxTransformBodySize
+var errBodyTooLarge = errors.New("超过转换的大小限制")
+
+// transformedBody 转换后的响应体，关闭时关闭上游的响应体
+type transformedBody struct {
+	io.Reader
+	body io.Closer
+}
+
+// Close 实现 io.Closer
+func (b *transformedBody) Close() error {
+	return b.body.Close()
+}
+
+// responseBodyTransform 返回需要执行的响应体转换，Content-Type 或状态码不匹配时返回 nil
+func responseBodyTransform(rule *config.ProxyRule, resp *http.Response) *config.BodyTransformConfig {
+	if rule.Transform == nil || rule.Transform.ResponseBody == nil {
+		return nil
+	}
+	transform := rule.Transform.ResponseBody
+	if !transform.Matches(resp.Header.Get("Content-Type"), resp.StatusCode) {
+		return nil
+	}
+	return transform
+}
+
+// transformResponseBody 读取完整的响应体并执行转换，把 resp.Body 替换为转换后的内容
+// 响应体超过 maxTransformBodySize、编码不支持或转换失败时返回错误，resp.Body 仍然是完整的原始响应体
+// gzip 编码的响应体解压后转换，转换后不再压缩
+func transformResponseBody(c *app.RequestContext, resp *http.Response, transform *config.BodyTransformConfig, vars *templateVars) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding != "" && encoding != "identity" && encoding != "gzip" {
+		return fmt.Errorf("不支持的 Content-Encoding %q", encoding)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxTransformBodySize+1))
+	original := resp.Body
+	restore := func() {
+		resp.Body = &transformedBody{Reader: io.MultiReader(bytes.NewReader(raw), original), body: original}
+	}
+	if err != nil {
+		restore()
+		return fmt.Errorf("读取响应体失败: %w", err)
+	}
+	if len(raw) > maxTransformBodySize {
+		restore()
+		return fmt.Errorf("响应体%w（%d 字节）", errBodyTooLarge, maxTransformBodySize)
+	}
+
+	data := raw
+	if encoding == "gzip" {
+		if data, err = gunzip(raw); err != nil {
+			restore()
+			return err
+		}
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		// 空响应体不需要转换
+		restore()
+		return nil
+	}
+
+	templateData := map[string]interface{}{
+		"status":  resp.StatusCode,
+		"request": vars.requestData(),
+	}
+	doc, err := decodeJSON(data)
+	if err != nil {
+		restore()
+		return fmt.Errorf("解析 JSON 失败: %w", err)
+	}
+	if doc, err = applyBodyTransformSteps(doc, transform.Steps, templateData); err != nil {
+		restore()
+		return err
+	}
+	out, err := encodeJSON(doc)
+	if err != nil {
+		restore()
+		return err
+	}
+
+	resp.Body = &transformedBody{Reader: bytes.NewReader(out), body: original}
+	resp.ContentLength = int64(len(out))
+	c.Response.Header.Del("Content-Encoding")
+	c.Response.Header.Del("ETag")
+	return nil
+}
+
+// gunzip 解压 gzip 编码的请求体或响应体，解压后的大小同样受 maxTransformBodySize 限制
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解压失败: %w", err)
+	}
+	defer reader.Close()
+
+	out, err := io.ReadAll(io.LimitReader(reader, maxTransformBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("解压失败: %w", err)
+	}
+	if len(out) > maxTransformBodySize {
+		return nil, fmt.Errorf("解压后%w（%d 字节）", errBodyTooLarge, maxTransformBodySize)
+	}
+	return out, nil
+}
+
+// requestBodyTransform 返回需要执行的请求体转换，Content-Type 不匹配或没有请求体时返回 nil
+func requestBodyTransform(rule *config.ProxyRule, c *app.RequestContext) *config.BodyTransformConfig {
+	if rule.Transform == nil || rule.Transform.RequestBody == nil || c.Request.Header.ContentLength() == 0 {
+		return nil
+	}
+	transform := rule.Transform.RequestBody
+	if !transform.Matches(string(c.Request.Header.ContentType()), 0) {
+		return nil
+	}
+	return transform
+}
+
+// transformRequestBody 读取完整的请求体并执行转换，替换转发的请求体
+// 转发时的 Content-Length 取转换后的长度；格式转换后同时修改 Content-Type，gzip 编码的请求体解压后转换，转换后不再压缩
+func transformRequestBody(c *app.RequestContext, body *requestBody, transform *config.BodyTransformConfig, vars *templateVars) error {
+	encoding := strings.ToLower(strings.TrimSpace(string(c.Request.Header.Peek("Content-Encoding"))))
+	if encoding != "" && encoding != "identity" && encoding != "gzip" {
+		return fmt.Errorf("不支持的 Content-Encoding %q", encoding)
+	}
+
+	data, err := body.ReadAll(maxTransformBodySize)
+	if err != nil {
+		return err
+	}
+	if encoding == "gzip" {
+		if data, err = gunzip(data); err != nil {
+			return err
+		}
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	var doc interface{}
+	if transform.Convert == config.BodyConvertFormToJSON {
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return fmt.Errorf("解析表单失败: %w", err)
+		}
+		doc = formToJSON(values)
+	} else if doc, err = decodeJSON(data); err != nil {
+		return fmt.Errorf("解析 JSON 失败: %w", err)
+	}
+
+	templateData := map[string]interface{}{"request": vars.requestData()}
+	if doc, err = applyBodyTransformSteps(doc, transform.Steps, templateData); err != nil {
+		return err
+	}
+
+	var out []byte
+	contentType := ""
+	switch transform.Convert {
+	case config.BodyConvertFormToJSON:
+		contentType = "application/json"
+		out, err = encodeJSON(doc)
+	case config.BodyConvertJSONToForm:
+		contentType = "application/x-www-form-urlencoded"
+		out, err = jsonToForm(doc)
+	default:
+		out, err = encodeJSON(doc)
+	}
+	if err != nil {
+		return err
+	}
+
+	body.SetBody(out)
+	if contentType != "" {
+		c.Request.Header.SetContentTypeBytes([]byte(contentType))
+	}
+	c.Request.Header.Del("Content-Encoding")
+	return nil
+}
+
+// formToJSON 把表单转换为 JSON 对象，只有一个值的字段转换为字符串，多个值的字段转换为字符串数组
+func formToJSON(values url.Values) interface{} {
+	doc := make(map[string]interface{}, len(values))
+	for key, items := range values {
+		if len(items) == 1 {
+			doc[key] = items[0]
+			continue
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			list[i] = item
+		}
+		doc[key] = list
+	}
+	return doc
+}
+
+// jsonToForm 把 JSON 对象转换为表单，数组转换为同名的多个字段，嵌套的对象和数组编码为 JSON 字符串
+func jsonToForm(doc interface{}) ([]byte, error) {
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("只有 JSON 对象可以转换为表单")
+	}
+	values := make(url.Values, len(obj))
+	for key, value := range obj {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			text, err := formValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("字段 %q: %w", key, err)
+			}
+			values.Add(key, text)
+		}
+	}
+	return []byte(values.Encode()), nil
+}
+
+// formValue 把 JSON 值转换为表单字段的值，null 转换为空字符串
+func formValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	out, err := encodeJSON(v)
+	return string(out), err
+}
+
+// requestData 转换模板中 .request 的数据
+func (v *templateVars) requestData() map[string]interface{} {
+	query := make(map[string]string)
+	v.c.QueryArgs().VisitAll(func(key, value []byte) {
+		if _, ok := query[string(key)]; !ok {
+			query[string(key)] = string(value)
+		}
+	})
+	return map[string]interface{}{
+		"method":     string(v.c.Method()),
+		"path":       string(v.c.Path()),
+		"query":      query,
+		"params":     v.pathParams,
+		"client_ip":  v.client.ip,
+		"request_id": v.requestID,
+	}
+}
+
+// applyBodyTransformSteps 按顺序执行转换步骤，templateData 为模板中除 .body 以外的数据
+func applyBodyTransformSteps(doc interface{}, steps []config.BodyTransformStep, templateData map[string]interface{}) (interface{}, error) {
+	var err error
+	for i := range steps {
+		if doc, err = applyBodyTransformStep(doc, &steps[i], templateData); err != nil {
+			return nil, fmt.Errorf("第 %d 步: %w", i+1, err)
+		}
+	}
+	return doc, nil
+}
+
+// applyBodyTransformStep 执行一个转换步骤，返回新的 JSON 值
+func applyBodyTransformStep(doc interface{}, step *config.BodyTransformStep, templateData map[string]interface{}) (interface{}, error) {
+	switch {
+	case len(step.Pick) > 0:
+		return pickJSON(doc, step.Pick), nil
+	case len(step.Omit) > 0:
+		for _, path := range step.Omit {
+			doc = omitJSON(doc, config.SplitJSONPath(path))
+		}
+		return doc, nil
+	case len(step.Rename) > 0:
+		// map 没有顺序，按旧路径排序后执行，保证结果稳定
+		froms := make([]string, 0, len(step.Rename))
+		for from := range step.Rename {
+			froms = append(froms, from)
+		}
+		sort.Strings(froms)
+		for _, from := range froms {
+			doc = renameJSON(doc, config.SplitJSONPath(from), config.SplitJSONPath(step.Rename[from]))
+		}
+		return doc, nil
+	case step.MergePatch != nil:
+		return mergePatchJSON(doc, step.MergePatchValue()), nil
+	case len(step.JSONPatch) > 0:
+		return applyJSONPatch(doc, step.JSONPatch)
+	case len(step.Map) > 0:
+		return mapJSON(doc, step.Map)
+	case step.Template != "":
+		return renderBodyTemplate(doc, step, templateData)
+	case step.Wrap != "":
+		return map[string]interface{}{step.Wrap: doc}, nil
+	}
+	return doc, nil
+}
+
+// decodeJSON 解析 JSON，数字保留为 json.Number，避免大整数丢失精度
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("JSON 之后有多余的内容")
+	}
+	return doc, nil
+}
+
+// encodeJSON 编码 JSON，不转义 HTML 字符
+func encodeJSON(doc interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, fmt.Errorf("编码 JSON 失败: %w", err)
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// cloneJSON 深拷贝 JSON 值，配置中的值写入响应体前需要拷贝，避免后续步骤修改配置
+func cloneJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = cloneJSON(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = cloneJSON(value)
+		}
+		return out
+	}
+	return v
+}
+
+// arrayIndex 把路径中的一段解析为数组下标
+func arrayIndex(part string, length int) (int, bool) {
+	index, err := strconv.Atoi(part)
+	if err != nil || index < 0 || index >= length {
+		return 0, false
+	}
+	return index, true
+}
+
+// pickJSON 只保留指定路径的字段，数组需要用 # 表示每个元素；没有匹配的字段时返回空对象
+func pickJSON(doc interface{}, paths []string) interface{} {
+	var out interface{}
+	for _, path := range paths {
+		out = pickPath(doc, out, config.SplitJSONPath(path))
+	}
+	if out == nil {
+		return make(map[string]interface{})
+	}
+	return out
+}
+
+// pickPath 把 src 中 parts 路径上的字段合并到 dst 中，返回新的 dst
+func pickPath(src, dst interface{}, parts []string) interface{} {
+	if len(parts) == 0 {
+		return src
+	}
+	switch v := src.(type) {
+	case map[string]interface{}:
+		obj, _ := dst.(map[string]interface{})
+		if obj == nil {
+			obj = make(map[string]interface{})
+		}
+		if child, ok := v[parts[0]]; ok {
+			// 路径经过的值不是对象或数组时没有匹配，不输出该字段
+			if picked := pickPath(child, obj[parts[0]], parts[1:]); picked != nil || len(parts) == 1 {
+				obj[parts[0]] = picked
+			}
+		}
+		return obj
+	case []interface{}:
+		if parts[0] != "#" {
+			return dst
+		}
+		arr, _ := dst.([]interface{})
+		if arr == nil {
+			arr = make([]interface{}, len(v))
+		}
+		for i := range v {
+			arr[i] = pickPath(v[i], arr[i], parts[1:])
+		}
+		return arr
+	}
+	return dst
+}
+
+// omitJSON 删除路径上的字段，# 表示数组的每个元素，最后一段是数组下标时删除该元素
+func omitJSON(doc interface{}, parts []string) interface{} {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if len(parts) == 1 {
+			delete(v, parts[0])
+		} else if child, ok := v[parts[0]]; ok {
+			v[parts[0]] = omitJSON(child, parts[1:])
+		}
+	case []interface{}:
+		if parts[0] == "#" {
+			if len(parts) == 1 {
+				return []interface{}{}
+			}
+			for i := range v {
+				v[i] = omitJSON(v[i], parts[1:])
+			}
+			return v
+		}
+		index, ok := arrayIndex(parts[0], len(v))
+		if !ok {
+			return v
+		}
+		if len(parts) == 1 {
+			return slices.Delete(v, index, index+1)
+		}
+		v[index] = omitJSON(v[index], parts[1:])
+	}
+	return doc
+}
+
+// getJSON 返回路径上的值
+func getJSON(doc interface{}, parts []string) (interface{}, bool) {
+	for _, part := range parts {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			child, ok := v[part]
+			if !ok {
+				return nil, false
+			}
+			doc = child
+		case []interface{}:
+			index, ok := arrayIndex(part, len(v))
+			if !ok {
+				return nil, false
+			}
+			doc = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// setJSON 设置路径上的值，不存在的对象会被创建，数组只能设置已有的下标
+func setJSON(doc interface{}, parts []string, value interface{}) interface{} {
+	if len(parts) == 0 {
+		return value
+	}
+	if arr, ok := doc.([]interface{}); ok {
+		if index, ok := arrayIndex(parts[0], len(arr)); ok {
+			arr[index] = setJSON(arr[index], parts[1:], value)
+		}
+		return arr
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		obj = make(map[string]interface{})
+	}
+	obj[parts[0]] = setJSON(obj[parts[0]], parts[1:], value)
+	return obj
+}
+
+// renameJSON 把 from 路径上的值移动到 to 路径，两个路径相同的前缀中 # 表示对数组的每个元素重命名
+func renameJSON(doc interface{}, from, to []string) interface{} {
+	if len(from) > 1 && len(to) > 1 && from[0] == to[0] {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			if child, ok := v[from[0]]; ok {
+				v[from[0]] = renameJSON(child, from[1:], to[1:])
+			}
+		case []interface{}:
+			if from[0] == "#" {
+				for i := range v {
+					v[i] = renameJSON(v[i], from[1:], to[1:])
+				}
+			} else if index, ok := arrayIndex(from[0], len(v)); ok {
+				v[index] = renameJSON(v[index], from[1:], to[1:])
+			}
+		}
+		return doc
+	}
+
+	value, ok := getJSON(doc, from)
+	if !ok {
+		return doc
+	}
+	return setJSON(omitJSON(doc, from), to, value)
+}
+
+// mergePatchJSON 执行 JSON Merge Patch（RFC 7386）：null 删除字段，对象递归合并，其他值直接替换
+func mergePatchJSON(doc, patch interface{}) interface{} {
+	fields, ok := patch.(map[string]interface{})
+	if !ok {
+		return cloneJSON(patch)
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		obj = make(map[string]interface{})
+	}
+	for key, value := range fields {
+		if value == nil {
+			delete(obj, key)
+		} else {
+			obj[key] = mergePatchJSON(obj[key], value)
+		}
+	}
+	return obj
+}
+
+// mapJSON 按 gjson 路径从原 JSON 中取值，组成新的 JSON 对象，不存在的值跳过
+func mapJSON(doc interface{}, mapping map[string]string) (interface{}, error) {
+	raw, err := encodeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(mapping))
+	for path := range mapping {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var out interface{} = make(map[string]interface{})
+	for _, path := range paths {
+		result := gjson.GetBytes(raw, mapping[path])
+		if !result.Exists() {
+			continue
+		}
+		value, err := decodeJSON([]byte(result.Raw))
+		if err != nil {
+			return nil, fmt.Errorf("map %s: %w", path, err)
+		}
+		out = setJSON(out, config.SplitJSONPath(path), value)
+	}
+	return out, nil
+}
+
+// renderBodyTemplate 执行模板，模板的输出必须是合法的 JSON
+func renderBodyTemplate(doc interface{}, step *config.BodyTransformStep, templateData map[string]interface{}) (interface{}, error) {
+	tmpl, err := step.CompiledTemplate()
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{"body": doc}
+	for key, value := range templateData {
+		data[key] = value
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("执行模板失败: %w", err)
+	}
+	out, err := decodeJSON(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("模板输出的不是合法的 JSON: %w", err)
+	}
+	return out, nil
+}
+
+// applyJSONPatch 执行 JSON Patch（RFC 6902），任一操作失败时整个转换失败
+func applyJSONPatch(doc interface{}, ops []config.JSONPatchOperation) (interface{}, error) {
+	for i := range ops {
+		op := &ops[i]
+		path := parsePointer(op.Path)
+		var err error
+		switch op.Op {
+		case "add":
+			doc, err = pointerAdd(doc, path, cloneJSON(op.JSONValue()))
+		case "remove":
+			doc, _, err = pointerRemove(doc, path)
+		case "replace":
+			if len(path) == 0 {
+				doc = cloneJSON(op.JSONValue())
+				break
+			}
+			if doc, _, err = pointerRemove(doc, path); err == nil {
+				doc, err = pointerAdd(doc, path, cloneJSON(op.JSONValue()))
+			}
+		case "move":
+			if op.Path == op.From {
+				break
+			}
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				err = fmt.Errorf("不能移动到自己的子节点")
+				break
+			}
+			var value interface{}
+			if doc, value, err = pointerRemove(doc, parsePointer(op.From)); err == nil {
+				doc, err = pointerAdd(doc, path, value)
+			}
+		case "copy":
+			var value interface{}
+			if value, err = pointerGet(doc, parsePointer(op.From)); err == nil {
+				doc, err = pointerAdd(doc, path, cloneJSON(value))
+			}
+		case "test":
+			var value interface{}
+			if value, err = pointerGet(doc, path); err == nil && !jsonEqual(value, op.JSONValue()) {
+				err = fmt.Errorf("值不相等")
+			}
+		default:
+			err = fmt.Errorf("未知的操作")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("json_patch 第 %d 个操作（%s %s）: %w", i+1, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+// parsePointer 解析 JSON Pointer（RFC 6901），空字符串表示整个文档
+func parsePointer(pointer string) []string {
+	if pointer == "" {
+		return nil
+	}
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens
+}
+
+// pointerIndex 把 JSON Pointer 的一段解析为数组下标，不允许前导 0
+func pointerIndex(token string, length int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || strconv.Itoa(index) != token {
+		return 0, fmt.Errorf("%q 不是有效的数组下标", token)
+	}
+	if index < 0 || index >= length {
+		return 0, fmt.Errorf("数组下标 %d 越界", index)
+	}
+	return index, nil
+}
+
+// pointerGet 返回 JSON Pointer 指向的值
+func pointerGet(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			child, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("字段 %q 不存在", token)
+			}
+			doc = child
+		case []interface{}:
+			index, err := pointerIndex(token, len(v))
+			if err != nil {
+				return nil, err
+			}
+			doc = v[index]
+		default:
+			return nil, fmt.Errorf("%q 的父节点不是对象或数组", token)
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd 在 JSON Pointer 指向的位置添加值：对象中添加或替换字段，数组中插入元素，- 表示追加到末尾
+func pointerAdd(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	token := tokens[0]
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if len(tokens) == 1 {
+			v[token] = value
+			return v, nil
+		}
+		child, ok := v[token]
+		if !ok {
+			return nil, fmt.Errorf("字段 %q 不存在", token)
+		}
+		child, err := pointerAdd(child, tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v[token] = child
+		return v, nil
+	case []interface{}:
+		if len(tokens) == 1 {
+			if token == "-" {
+				return append(v, value), nil
+			}
+			// 插入时下标可以等于数组长度
+			index, err := pointerIndex(token, len(v)+1)
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(v, index, value), nil
+		}
+		index, err := pointerIndex(token, len(v))
+		if err != nil {
+			return nil, err
+		}
+		child, err := pointerAdd(v[index], tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v[index] = child
+		return v, nil
+	}
+	return nil, fmt.Errorf("%q 的父节点不是对象或数组", token)
+}
+
+// pointerRemove 删除 JSON Pointer 指向的值，同时返回被删除的值
+func pointerRemove(doc interface{}, tokens []string) (interface{}, interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("不能删除整个文档")
+	}
+	token := tokens[0]
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		child, ok := v[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("字段 %q 不存在", token)
+		}
+		if len(tokens) == 1 {
+			delete(v, token)
+			return v, child, nil
+		}
+		child, removed, err := pointerRemove(child, tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		v[token] = child
+		return v, removed, nil
+	case []interface{}:
+		index, err := pointerIndex(token, len(v))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(tokens) == 1 {
+			removed := v[index]
+			return slices.Delete(v, index, index+1), removed, nil
+		}
+		child, removed, err := pointerRemove(v[index], tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		v[index] = child
+		return v, removed, nil
+	}
+	return nil, nil, fmt.Errorf("%q 的父节点不是对象或数组", token)
+}
+
+// jsonEqual 比较两个 JSON 值是否相等，数字按数值比较
+func jsonEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		return errX == nil && errY == nil && fx == fy
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// mustDecodeJSON 解析测试用的 JSON
+func mustDecodeJSON(t *testing.T, s string) interface{} {
+	t.Helper()
+
+	doc, err := decodeJSON([]byte(s))
+	if err != nil {
+		t.Fatalf("解析 %s 失败: %v", s, err)
+	}
+	return doc
+}
+
+// patch 构造 json_patch 操作，value 为 JSON 文本
+func patch(t *testing.T, op, path, from, value string) config.JSONPatchOperation {
+	t.Helper()
+
+	operation := config.JSONPatchOperation{Op: op, Path: path, From: from}
+	if value != "" {
+		operation.Value = mustDecodeJSON(t, value)
+	}
+	return operation
+}
+
+// TestBodyTransformSteps 每种转换步骤的结果，want 为空时期望失败，错误信息包含 wantErr
+func TestBodyTransformSteps(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		step    config.BodyTransformStep
+		want    string
+		wantErr string
+	}{
+		// pick
+		{name: "pick 嵌套字段", doc: `{"a":1,"b":{"c":2,"d":3}}`, step: config.BodyTransformStep{Pick: []string{"b.c"}}, want: `{"b":{"c":2}}`},
+		{name: "pick 多个路径合并", doc: `{"a":1,"b":{"c":2,"d":3},"e":4}`, step: config.BodyTransformStep{Pick: []string{"a", "b.d"}}, want: `{"a":1,"b":{"d":3}}`},
+		{name: "pick 数组的每个元素", doc: `{"items":[{"id":1,"x":2},{"id":2,"x":3}]}`, step: config.BodyTransformStep{Pick: []string{"items.#.id"}}, want: `{"items":[{"id":1},{"id":2}]}`},
+		{name: "pick 数组元素的多个字段", doc: `{"items":[{"id":1,"x":2,"y":3}]}`, step: config.BodyTransformStep{Pick: []string{"items.#.id", "items.#.y"}}, want: `{"items":[{"id":1,"y":3}]}`},
+		{name: "pick 数组没有用 #", doc: `{"items":[{"id":1}]}`, step: config.BodyTransformStep{Pick: []string{"items.0.id"}}, want: `{}`},
+		{name: "pick 顶层数组", doc: `[{"id":1,"x":2}]`, step: config.BodyTransformStep{Pick: []string{"#.id"}}, want: `[{"id":1}]`},
+		{name: "pick 没有匹配的字段", doc: `{"a":1}`, step: config.BodyTransformStep{Pick: []string{"missing"}}, want: `{}`},
+		{name: "pick 路径经过非对象的值", doc: `{"a":1,"b":2}`, step: config.BodyTransformStep{Pick: []string{"a.c", "b"}}, want: `{"b":2}`},
+		{name: "pick 顶层不是对象", doc: `[1,2]`, step: config.BodyTransformStep{Pick: []string{"a"}}, want: `{}`},
+		{name: "pick 保留 null", doc: `{"a":null,"b":1}`, step: config.BodyTransformStep{Pick: []string{"a"}}, want: `{"a":null}`},
+		{name: "pick 字段名中的点", doc: `{"a.b":1,"a":{"b":2}}`, step: config.BodyTransformStep{Pick: []string{`a\.b`}}, want: `{"a.b":1}`},
+
+		// omit
+		{name: "omit 嵌套字段", doc: `{"a":1,"b":{"c":2,"d":3}}`, step: config.BodyTransformStep{Omit: []string{"b.c"}}, want: `{"a":1,"b":{"d":3}}`},
+		{name: "omit 数组每个元素的字段", doc: `{"items":[{"id":1,"x":2},{"id":2,"x":3}]}`, step: config.BodyTransformStep{Omit: []string{"items.#.x"}}, want: `{"items":[{"id":1},{"id":2}]}`},
+		{name: "omit 数组元素", doc: `{"items":[1,2,3]}`, step: config.BodyTransformStep{Omit: []string{"items.1"}}, want: `{"items":[1,3]}`},
+		{name: "omit 数组的所有元素", doc: `{"items":[1,2,3]}`, step: config.BodyTransformStep{Omit: []string{"items.#"}}, want: `{"items":[]}`},
+		{name: "omit 不存在的字段", doc: `{"a":1}`, step: config.BodyTransformStep{Omit: []string{"b.c", "a.x", "items.5"}}, want: `{"a":1}`},
+		{name: "omit 下标越界", doc: `{"items":[1]}`, step: config.BodyTransformStep{Omit: []string{"items.1"}}, want: `{"items":[1]}`},
+
+		// rename
+		{name: "rename 移动到新路径", doc: `{"a":1,"b":2}`, step: config.BodyTransformStep{Rename: map[string]string{"a": "x.y"}}, want: `{"b":2,"x":{"y":1}}`},
+		{name: "rename 数组每个元素", doc: `{"items":[{"amount":1},{"amount":2}]}`, step: config.BodyTransformStep{Rename: map[string]string{"items.#.amount": "items.#.total"}}, want: `{"items":[{"total":1},{"total":2}]}`},
+		{name: "rename 不存在的字段", doc: `{"a":1}`, step: config.BodyTransformStep{Rename: map[string]string{"b": "c"}}, want: `{"a":1}`},
+		{name: "rename 按旧路径排序执行", doc: `{"a":1,"b":2}`, step: config.BodyTransformStep{Rename: map[string]string{"a": "b", "b": "c"}}, want: `{"c":1}`},
+
+		// merge_patch
+		{name: "merge_patch null 删除字段", doc: `{"a":1,"b":2}`, step: config.BodyTransformStep{MergePatch: mustDecodeJSON(t, `{"a":null,"c":{"d":1}}`)}, want: `{"b":2,"c":{"d":1}}`},
+		{name: "merge_patch 递归合并", doc: `{"a":{"b":1,"c":2}}`, step: config.BodyTransformStep{MergePatch: mustDecodeJSON(t, `{"a":{"b":null,"d":3}}`)}, want: `{"a":{"c":2,"d":3}}`},
+		{name: "merge_patch null 删除不存在的字段", doc: `{"a":1}`, step: config.BodyTransformStep{MergePatch: mustDecodeJSON(t, `{"b":null}`)}, want: `{"a":1}`},
+		{name: "merge_patch 数组整体替换", doc: `{"a":[1,2]}`, step: config.BodyTransformStep{MergePatch: mustDecodeJSON(t, `{"a":[3]}`)}, want: `{"a":[3]}`},
+		{name: "merge_patch 补丁不是对象", doc: `{"a":1}`, step: config.BodyTransformStep{MergePatch: mustDecodeJSON(t, `[1]`)}, want: `[1]`},
+		{name: "merge_patch 原文不是对象", doc: `"x"`, step: config.BodyTransformStep{MergePatch: mustDecodeJSON(t, `{"a":{"b":null,"c":1}}`)}, want: `{"a":{"c":1}}`},
+
+		// json_patch
+		{name: "json_patch /- 追加到数组末尾", doc: `{"a":[1]}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "add", "/a/-", "", `2`)}}, want: `{"a":[1,2]}`},
+		{name: "json_patch 插入到数组下标", doc: `{"a":[1,2]}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "add", "/a/0", "", `0`), patch(t, "add", "/a/3", "", `3`)}}, want: `{"a":[0,1,2,3]}`},
+		{name: "json_patch 插入下标越界", doc: `{"a":[1]}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "add", "/a/2", "", `2`)}}, wantErr: "越界"},
+		{name: "json_patch 下标有前导 0", doc: `{"a":[1,2]}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "remove", "/a/01", "", "")}}, wantErr: "不是有效的数组下标"},
+		{name: "json_patch 父节点不存在", doc: `{}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "add", "/a/b", "", `1`)}}, wantErr: "不存在"},
+		{name: "json_patch 替换整个文档", doc: `{"a":1}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "replace", "", "", `[1]`)}}, want: `[1]`},
+		{name: "json_patch remove 和 replace", doc: `{"a":[1,2],"b":1}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "remove", "/a/0", "", ""), patch(t, "replace", "/b", "", `{"c":2}`)}}, want: `{"a":[2],"b":{"c":2}}`},
+		{name: "json_patch replace 不存在的字段", doc: `{}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "replace", "/a", "", `1`)}}, wantErr: "不存在"},
+		{name: "json_patch move", doc: `{"a":{"b":1},"c":[]}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "move", "/c/-", "/a/b", "")}}, want: `{"a":{},"c":[1]}`},
+		{name: "json_patch move 到同一位置", doc: `{"a":1}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "move", "/a", "/a", "")}}, want: `{"a":1}`},
+		{name: "json_patch move 源不存在", doc: `{"a":1}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "move", "/b", "/x", "")}}, wantErr: "不存在"},
+		{name: "json_patch move 到自己的子节点", doc: `{"a":{"b":1}}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "move", "/a/b/c", "/a", "")}}, wantErr: "子节点"},
+		{name: "json_patch copy 深拷贝", doc: `{"a":[1]}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "copy", "/b", "/a", ""), patch(t, "add", "/b/-", "", `2`)}}, want: `{"a":[1],"b":[1,2]}`},
+		{name: "json_patch copy 源不存在", doc: `{"a":1}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "copy", "/b", "/x/y", "")}}, wantErr: "不存在"},
+		{name: "json_patch test 数字按数值比较", doc: `{"a":1,"b":{"c":[1,"x"]}}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "test", "/a", "", `1.0`), patch(t, "test", "/b", "", `{"c":[1,"x"]}`)}}, want: `{"a":1,"b":{"c":[1,"x"]}}`},
+		{name: "json_patch test 不相等", doc: `{"a":1}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "test", "/a", "", `"1"`)}}, wantErr: "值不相等"},
+		{name: "json_patch test 路径不存在", doc: `{"a":1}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "test", "/b", "", `null`)}}, wantErr: "不存在"},
+		{name: "json_patch 转义的路径", doc: `{"a/b":1,"m~n":2}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "remove", "/a~1b", "", ""), patch(t, "move", "/x", "/m~0n", "")}}, want: `{"x":2}`},
+		{name: "json_patch 未知的操作", doc: `{}`, step: config.BodyTransformStep{JSONPatch: []config.JSONPatchOperation{patch(t, "merge", "/a", "", `1`)}}, wantErr: "未知的操作"},
+
+		// map 和 wrap
+		{name: "map gjson 路径", doc: `{"user":{"name":"x"},"orders":[{"id":1},{"id":2}]}`, step: config.BodyTransformStep{Map: map[string]string{"name": "user.name", "count": "orders.#", "ids": "orders.#.id", "info.missing": "user.age"}}, want: `{"count":2,"ids":[1,2],"name":"x"}`},
+		{name: "wrap", doc: `[1]`, step: config.BodyTransformStep{Wrap: "data"}, want: `{"data":[1]}`},
+		{name: "数字保持原样", doc: `{"id":12345678901234567890,"f":1.50}`, step: config.BodyTransformStep{Pick: []string{"id", "f"}}, want: `{"f":1.50,"id":12345678901234567890}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyBodyTransformSteps(mustDecodeJSON(t, tt.doc), []config.BodyTransformStep{tt.step}, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := encodeJSON(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got %s, want %s", out, tt.want)
+			}
+		})
+	}
+}
+
+// TestBodyTransformStepsChain 后面的步骤处理前面步骤的结果，模板可以使用请求信息
+func TestBodyTransformStepsChain(t *testing.T) {
+	steps := []config.BodyTransformStep{
+		{Pick: []string{"data.user.nick_name", "data.orders.#.id"}},
+		{Rename: map[string]string{"data.user.nick_name": "data.user.nickname"}},
+		{JSONPatch: []config.JSONPatchOperation{patch(t, "move", "/orders", "/data/orders", "")}},
+		{Template: `{"id": {{ json .request.params.id }}, "user": {{ json .body.data.user }}, "orders": {{ json .body.orders }}, "status": {{ .status }}}`},
+	}
+	doc := mustDecodeJSON(t, `{"data":{"user":{"nick_name":"a","password":"x"},"orders":[{"id":1,"amount":2}]},"debug":true}`)
+	templateData := map[string]interface{}{
+		"status":  200,
+		"request": map[string]interface{}{"params": map[string]string{"id": "42"}},
+	}
+
+	got, err := applyBodyTransformSteps(doc, steps, templateData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := encodeJSON(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":"42","orders":[{"id":1}],"status":200,"user":{"nickname":"a"}}`
+	if string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+}
@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// 熔断器状态
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// breakerSet 熔断器集合，按目标地址保存状态，配置了熔断器的规则共享；没有配置熔断器的规则不受熔断状态影响
+type breakerSet struct {
+	mu       sync.Mutex
+	breakers map[string]*breaker // 目标地址 -> 熔断器
+}
+
+// breaker 单个目标的熔断器
+type breaker struct {
+	state       string
+	windowStart time.Time // 关闭状态：统计窗口开始时间
+	total       int       // 关闭状态：窗口内的请求数
+	failures    int       // 关闭状态：窗口内的失败数
+	slow        int       // 关闭状态：窗口内的慢请求数
+	openedAt    time.Time // 最近一次熔断时间
+	openUntil   time.Time // 熔断截止时间，之后进入半开状态
+	probes      int       // 半开状态：允许通过的探测请求数
+	inflight    int       // 半开状态：已占用的探测名额
+	generation  int       // 每次进入半开状态加一（从 1 开始），上一轮半开状态占用的名额不再释放，结果也不再统计
+	successes   int       // 半开状态：成功的探测请求数
+	lastReason  string    // 最近一次熔断原因
+}
+
+// BreakerStatus 熔断器状态（用于管理接口）
+type BreakerStatus struct {
+	URL        string    `json:"url"`
+	Rules      []string  `json:"rules"`                 // 使用该目标且配置了熔断器的规则
+	State      string    `json:"state"`                 // closed、open、half_open
+	Total      int       `json:"total"`                 // 当前窗口内的请求数
+	Failures   int       `json:"failures"`              // 当前窗口内的失败数
+	Slow       int       `json:"slow"`                  // 当前窗口内的慢请求数
+	OpenedAt   time.Time `json:"opened_at"`             // 最近一次熔断时间
+	OpenUntil  time.Time `json:"open_until"`            // 熔断截止时间
+	LastReason string    `json:"last_reason,omitempty"` // 最近一次熔断原因
+}
+
+// newBreakerSet 创建熔断器集合
+func newBreakerSet() *breakerSet {
+	return &breakerSet{breakers: make(map[string]*breaker)}
+}
+
+// get 返回目标的熔断器，并把到期的熔断切换为半开状态（需要先获取锁）
+func (s *breakerSet) get(target string) *breaker {
+	b, ok := s.breakers[target]
+	if !ok {
+		b = &breaker{state: breakerClosed, windowStart: time.Now()}
+		s.breakers[target] = b
+	}
+	if b.state == breakerOpen && !time.Now().Before(b.openUntil) {
+		b.state = breakerHalfOpen
+		b.inflight = 0
+		b.successes = 0
+		b.generation++
+	}
+	return b
+}
+
+// available 判断目标是否可以分配请求（不占用名额，用于筛选候选目标）：熔断中不可用，半开状态只放行有限的探测请求
+func (s *breakerSet) available(target string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[target]
+	if !ok {
+		return true
+	}
+	b = s.get(target)
+	switch b.state {
+	case breakerOpen:
+		return false
+	case breakerHalfOpen:
+		return b.inflight < b.probes
+	}
+	return true
+}
+
+// reserve 选中目标时调用：检查目标是否可用，半开状态下同时占用一个探测名额，检查和占用在同一个临界区内完成，
+// 并发的请求不会超过 half_open_requests。返回的函数在请求结束时调用以释放名额，没有配置熔断器时总是可用；
+// probe 为占用名额时的半开轮次，记录结果时传给 record，没有占用名额时为 0
+func (s *breakerSet) reserve(target string, cfg *config.BreakerConfig) (func(), int, bool) {
+	if cfg == nil {
+		return func() {}, 0, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.get(target)
+	switch b.state {
+	case breakerOpen:
+		return nil, 0, false
+	case breakerHalfOpen:
+		if b.inflight >= b.probes {
+			return nil, 0, false
+		}
+		b.inflight++
+		generation := b.generation
+		return func() { s.end(target, generation) }, generation, true
+	}
+	return func() {}, 0, true
+}
+
+// end 释放 reserve 占用的探测名额，不统计成功或失败
+func (s *breakerSet) end(target string, generation int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b := s.breakers[target]; b != nil && b.generation == generation && b.inflight > 0 {
+		b.inflight--
+	}
+}
+
+// record 记录一次转发结果，失败率或慢请求比例超过阈值时熔断
+// probe 为 reserve 返回的半开轮次，半开状态只统计本轮探测请求的结果
+func (s *breakerSet) record(target string, cfg *config.BreakerConfig, probe int, success bool, latency time.Duration) {
+	if cfg == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.get(target)
+	slow := cfg.SlowThreshold > 0 && latency > time.Duration(cfg.SlowThreshold)*time.Millisecond
+
+	switch b.state {
+	case breakerOpen:
+		// 熔断前发出的请求，结果不再统计
+		return
+
+	case breakerHalfOpen:
+		if probe != b.generation {
+			// 进入半开状态前发出的请求或上一轮的探测请求，结果不再统计
+			return
+		}
+		if !success {
+			b.open(cfg, "半开状态探测请求失败")
+			return
+		}
+		if slow {
+			b.open(cfg, "半开状态探测请求过慢")
+			return
+		}
+		b.successes++
+		if b.successes >= b.probes {
+			b.reset()
+		}
+		return
+	}
+
+	window := time.Duration(cfg.Window) * time.Second
+	if window <= 0 {
+		window = 10 * time.Second
+	}
+	if time.Since(b.windowStart) > window {
+		b.reset()
+	}
+
+	b.total++
+	if !success {
+		b.failures++
+	}
+	if slow {
+		b.slow++
+	}
+
+	minRequests := cfg.MinRequests
+	if minRequests <= 0 {
+		minRequests = 10
+	}
+	if b.total < minRequests {
+		return
+	}
+
+	failureRate := cfg.FailureRate
+	if failureRate <= 0 {
+		failureRate = 50
+	}
+	slowRate := cfg.SlowRate
+	if slowRate <= 0 {
+		slowRate = 50
+	}
+	switch {
+	case b.failures*100 >= b.total*failureRate:
+		b.open(cfg, "失败率超过阈值")
+	case cfg.SlowThreshold > 0 && b.slow*100 >= b.total*slowRate:
+		b.open(cfg, "慢请求比例超过阈值")
+	}
+}
+
+// open 进入熔断状态
+func (b *breaker) open(cfg *config.BreakerConfig, reason string) {
+	coolDown := time.Duration(cfg.CoolDown) * time.Second
+	if coolDown <= 0 {
+		coolDown = 30 * time.Second
+	}
+	probes := cfg.HalfOpenRequests
+	if probes <= 0 {
+		probes = 1
+	}
+
+	b.state = breakerOpen
+	b.openedAt = time.Now()
+	b.openUntil = b.openedAt.Add(coolDown)
+	b.probes = probes
+	b.lastReason = reason
+}
+
+// reset 关闭熔断并开始新的统计窗口
+func (b *breaker) reset() {
+	b.state = breakerClosed
+	b.windowStart = time.Now()
+	b.total = 0
+	b.failures = 0
+	b.slow = 0
+}
+
+// status 返回当前配置中所有配置了熔断器的上游目标状态
+func (s *breakerSet) status(cfg *config.Config) []BreakerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]BreakerStatus, 0)
+	index := make(map[string]int)
+	for _, rule := range cfg.Proxy.Rules {
+		if rule.Breaker == nil {
+			continue
+		}
+		for _, target := range rule.UpstreamTargets() {
+			if i, ok := index[target.URL]; ok {
+				statuses[i].Rules = append(statuses[i].Rules, rule.Name)
+				continue
+			}
+
+			b := s.get(target.URL)
+			index[target.URL] = len(statuses)
+			statuses = append(statuses, BreakerStatus{
+				URL:        target.URL,
+				Rules:      []string{rule.Name},
+				State:      b.state,
+				Total:      b.total,
+				Failures:   b.failures,
+				Slow:       b.slow,
+				OpenedAt:   b.openedAt,
+				OpenUntil:  b.openUntil,
+				LastReason: b.lastReason,
+			})
+		}
+	}
+	return statuses
+}
@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// openBreaker 让目标的熔断器熔断，冷却时间为 0，下一次检查时进入半开状态
+func openBreaker(s *breakerSet, target string, cfg *config.BreakerConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.get(target)
+	b.open(cfg, "测试")
+	b.openUntil = time.Now()
+}
+
+// TestBreakerReserveHalfOpen 半开状态下并发的请求最多占用 half_open_requests 个探测名额，释放后可以再次占用
+func TestBreakerReserveHalfOpen(t *testing.T) {
+	const target = "http://127.0.0.1:19001"
+	cfg := &config.BreakerConfig{HalfOpenRequests: 2}
+	s := newBreakerSet()
+	openBreaker(s, target, cfg)
+
+	var reserved atomic.Int32
+	releases := make(chan func(), 100)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if release, _, ok := s.reserve(target, cfg); ok {
+				reserved.Add(1)
+				releases <- release
+			}
+		}()
+	}
+	wg.Wait()
+	close(releases)
+	if got := reserved.Load(); got != 2 {
+		t.Fatalf("占用了 %d 个探测名额，want 2", got)
+	}
+
+	for release := range releases {
+		release()
+		release()
+	}
+	if _, _, ok := s.reserve(target, cfg); !ok {
+		t.Fatalf("释放后不能再次占用探测名额")
+	}
+}
+
+// TestBreakerReleaseAfterReopen 上一轮半开状态占用的名额在重新熔断后释放，不影响新一轮的名额
+func TestBreakerReleaseAfterReopen(t *testing.T) {
+	const target = "http://127.0.0.1:19001"
+	cfg := &config.BreakerConfig{HalfOpenRequests: 1}
+	s := newBreakerSet()
+	openBreaker(s, target, cfg)
+
+	stale, probe, ok := s.reserve(target, cfg)
+	if !ok {
+		t.Fatal("半开状态不能占用探测名额")
+	}
+	s.record(target, cfg, probe, false, 0)
+	openBreaker(s, target, cfg)
+
+	if _, _, ok := s.reserve(target, cfg); !ok {
+		t.Fatal("新一轮半开状态不能占用探测名额")
+	}
+	stale()
+	if _, _, ok := s.reserve(target, cfg); ok {
+		t.Fatal("上一轮的名额释放后，新一轮的名额超过了 half_open_requests")
+	}
+}
+
+// TestBreakerIgnoreStaleResults 半开状态只统计本轮探测请求的结果，熔断前发出的慢请求和上一轮的探测请求不能关闭或重新打开熔断器
+func TestBreakerIgnoreStaleResults(t *testing.T) {
+	const target = "http://127.0.0.1:19001"
+	cfg := &config.BreakerConfig{HalfOpenRequests: 1}
+
+	t.Run("关闭状态发出的请求", func(t *testing.T) {
+		s := newBreakerSet()
+		_, closedProbe, ok := s.reserve(target, cfg)
+		if !ok || closedProbe != 0 {
+			t.Fatalf("关闭状态: probe = %d, ok = %v", closedProbe, ok)
+		}
+		openBreaker(s, target, cfg)
+		_, probe, ok := s.reserve(target, cfg)
+		if !ok {
+			t.Fatal("半开状态不能占用探测名额")
+		}
+
+		s.record(target, cfg, closedProbe, true, 0)
+		if state := breakerState(s, target); state != breakerHalfOpen {
+			t.Fatalf("关闭状态发出的成功请求改变了半开状态: %s", state)
+		}
+		s.record(target, cfg, closedProbe, false, 0)
+		if state := breakerState(s, target); state != breakerHalfOpen {
+			t.Fatalf("关闭状态发出的失败请求改变了半开状态: %s", state)
+		}
+
+		s.record(target, cfg, probe, true, 0)
+		if state := breakerState(s, target); state != breakerClosed {
+			t.Fatalf("探测请求成功后没有关闭熔断器: %s", state)
+		}
+	})
+
+	t.Run("上一轮的探测请求", func(t *testing.T) {
+		s := newBreakerSet()
+		openBreaker(s, target, cfg)
+		_, stale, ok := s.reserve(target, cfg)
+		if !ok {
+			t.Fatal("半开状态不能占用探测名额")
+		}
+		// 重新熔断后进入新一轮半开状态，上一轮的探测请求还没有结束
+		openBreaker(s, target, cfg)
+		_, probe, ok := s.reserve(target, cfg)
+		if !ok || probe == stale {
+			t.Fatalf("新一轮半开状态: probe = %d, stale = %d, ok = %v", probe, stale, ok)
+		}
+
+		s.record(target, cfg, stale, false, 0)
+		if state := breakerState(s, target); state != breakerHalfOpen {
+			t.Fatalf("上一轮的探测请求失败后重新熔断: %s", state)
+		}
+		s.record(target, cfg, probe, false, 0)
+		if state := breakerState(s, target); state != breakerOpen {
+			t.Fatalf("本轮探测请求失败后没有重新熔断: %s", state)
+		}
+	})
+}
+
+// breakerState 返回目标熔断器的当前状态
+func breakerState(s *breakerSet, target string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(target).state
+}
+
+// TestBalancerBreakerPerRule 没有配置熔断器的规则不受同一目标上其他规则的熔断状态影响
+func TestBalancerBreakerPerRule(t *testing.T) {
+	const target = "http://127.0.0.1:19001"
+	p := NewProxyMiddleware(loadTestConfig(t, `proxy:
+  rules:
+    - name: with-breaker
+      match:
+        path: /a
+      target: `+target+`
+      circuit_breaker: {}
+    - name: without-breaker
+      match:
+        path: /b
+      target: `+target+`
+`))
+	cfg := config.GetConfig()
+	withBreaker, withoutBreaker := &cfg.Proxy.Rules[0], &cfg.Proxy.Rules[1]
+	p.breakers.mu.Lock()
+	p.breakers.get(target).open(withBreaker.Breaker, "测试")
+	p.breakers.mu.Unlock()
+
+	c := app.NewContext(0)
+	c.Request.Header.SetMethod(http.MethodGet)
+	if _, _, _, err := p.balancer.pick(c, withBreaker); err == nil {
+		t.Error("配置了熔断器的规则选中了已熔断的目标")
+	}
+	got, done, _, err := p.balancer.pick(c, withoutBreaker)
+	if err != nil || got != target {
+		t.Fatalf("没有配置熔断器的规则: got %q, %v", got, err)
+	}
+	done()
+}
@@ -0,0 +1,371 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/tidwall/gjson"
+	"github.com/without-php/BFF-proxy/internal/config"
+	"github.com/without-php/BFF-proxy/internal/logger"
+)
+
+// compositeErrorsField 部分子请求失败时，合并结果中记录失败原因的字段
+const compositeErrorsField = "_errors"
+
+// compositeCall 聚合规则中一个子请求的执行状态
+type compositeCall struct {
+	call  *config.CompositeCall
+	done  chan struct{} // 子请求结束（成功、失败或因依赖失败而跳过）后关闭
+	raw   []byte        // 转换后的响应体，供依赖它的子请求在模板中引用
+	value interface{}   // 转换后的响应体
+	err   error
+	log   *logger.RequestLog
+}
+
+// compositeRequest 一次聚合请求的执行上下文
+type compositeRequest struct {
+	rule        *config.ProxyRule
+	vars        *templateVars
+	calls       map[string]*compositeCall
+	requestData map[string]interface{} // 转换模板中的 .request，子请求并发执行之前准备好
+	maxBodySize int
+
+	mu sync.Mutex // 子请求并发读取客户端请求时加锁，Hertz 的查询参数和 Cookie 在第一次读取时才解析
+}
+
+// lookup 返回模板变量的值，{call.名称.路径} 从依赖的子请求的响应体中取值
+func (r *compositeRequest) lookup(source, name string) string {
+	if source == config.TemplateSourceCall {
+		return r.callValue(name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.vars.lookup(source, name)
+}
+
+// callValue 返回子请求响应体中 gjson 路径的值，name 为“名称.路径”，没有路径时返回整个响应体
+func (r *compositeRequest) callValue(name string) string {
+	result, ok := r.callResult(name)
+	if !ok {
+		return ""
+	}
+	return result.String()
+}
+
+// callResult 查找子请求响应体中 gjson 路径的值
+func (r *compositeRequest) callResult(name string) (gjson.Result, bool) {
+	callName, path, _ := strings.Cut(name, ".")
+	call, ok := r.calls[callName]
+	if !ok || call.raw == nil {
+		return gjson.Result{}, false
+	}
+	if path == "" {
+		return gjson.ParseBytes(call.raw), true
+	}
+	result := gjson.GetBytes(call.raw, path)
+	return result, result.Exists()
+}
+
+// jsonLookup 返回 JSON 编码后的模板变量值，用于请求体模板：
+// {call...} 为子请求响应体中的原始 JSON（不存在时为 null），其他变量编码为 JSON 字符串
+func (r *compositeRequest) jsonLookup(source, name string) string {
+	if source == config.TemplateSourceCall {
+		result, ok := r.callResult(name)
+		if !ok {
+			return "null"
+		}
+		return result.Raw
+	}
+	data, _ := json.Marshal(r.lookup(source, name))
+	return string(data)
+}
+
+// handleComposite 处理聚合规则：按依赖关系发起子请求，没有依赖关系的子请求并行执行，结果合并为一个 JSON 对象
+// 规则的 timeout 限制整个聚合请求，子请求的 timeout 只限制该子请求
+func (p *ProxyMiddleware) handleComposite(ctx context.Context, c *app.RequestContext, rule *config.ProxyRule, vars *templateVars, reqLog *logger.RequestLog, maxBodySize int) {
+	composite := rule.Composite
+	ctx, cancel := context.WithTimeout(ctx, ruleTimeout(rule))
+	defer cancel()
+
+	run := &compositeRequest{
+		rule:        rule,
+		vars:        vars,
+		calls:       make(map[string]*compositeCall, len(composite.Calls)),
+		requestData: vars.requestData(),
+		maxBodySize: maxBodySize,
+	}
+	order := make([]*compositeCall, len(composite.Calls))
+	for i := range composite.Calls {
+		call := &compositeCall{
+			call: &composite.Calls[i],
+			done: make(chan struct{}),
+			log: &logger.RequestLog{
+				Call:   composite.Calls[i].Name,
+				Method: composite.Calls[i].RequestMethod(),
+				Target: composite.Calls[i].Target,
+			},
+		}
+		run.calls[call.call.Name] = call
+		order[i] = call
+	}
+
+	// 第一个失败的必需子请求，其他子请求因取消而失败时不覆盖
+	var failed *compositeCall
+	var failOnce sync.Once
+	for _, call := range order {
+		go func(call *compositeCall) {
+			defer close(call.done)
+			call.log.StartTime = time.Now()
+			call.err = p.runCompositeCall(ctx, run, call)
+			call.log.EndTime = time.Now()
+			call.log.Duration = call.log.EndTime.Sub(call.log.StartTime)
+			if call.err != nil {
+				call.log.Error = call.err.Error()
+				if !call.call.Optional && composite.FailFast() {
+					// 必需的子请求失败时整个聚合请求失败，取消其他子请求
+					failOnce.Do(func() {
+						failed = call
+						cancel()
+					})
+				}
+			}
+		}(call)
+	}
+
+	// 按配置顺序合并结果，失败的子请求结果为 null
+	var result interface{} = make(map[string]interface{})
+	failures := make(map[string]interface{})
+	for _, call := range order {
+		<-call.done
+		reqLog.Calls = append(reqLog.Calls, call.log)
+		if call.err != nil {
+			failures[call.call.Name] = call.err.Error()
+		}
+
+		switch path := call.call.ResultPath(); path {
+		case config.CompositeAsNone:
+		case config.CompositeAsRoot:
+			if fields, ok := call.value.(map[string]interface{}); ok {
+				for key, value := range fields {
+					result.(map[string]interface{})[key] = value
+				}
+			}
+		default:
+			result = setJSON(result, config.SplitJSONPath(path), call.value)
+		}
+	}
+
+	if failed != nil {
+		reqLog.EndTime = time.Now()
+		reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+		reqLog.StatusCode = http.StatusBadGateway
+		reqLog.Error = fmt.Sprintf("子请求 %q 失败: %v", failed.call.Name, failed.err)
+		logger.LogRequest(reqLog)
+
+		c.JSON(http.StatusBadGateway, map[string]string{
+			"error": fmt.Sprintf("聚合请求失败: %s", reqLog.Error),
+		})
+		return
+	}
+	if len(failures) > 0 {
+		result.(map[string]interface{})[compositeErrorsField] = failures
+		names := make([]string, 0, len(failures))
+		for _, call := range order {
+			if call.err != nil {
+				names = append(names, call.call.Name)
+			}
+		}
+		reqLog.Error = fmt.Sprintf("子请求失败: %s", strings.Join(names, ", "))
+	}
+
+	// 合并后的结果可以再经过响应体转换（不检查 Content-Type 和状态码）
+	var err error
+	if rule.Transform != nil && rule.Transform.ResponseBody != nil {
+		templateData := map[string]interface{}{
+			"status":  http.StatusOK,
+			"request": run.requestData,
+		}
+		result, err = applyBodyTransformSteps(result, rule.Transform.ResponseBody.Steps, templateData)
+	}
+	var out []byte
+	if err == nil {
+		out, err = encodeJSON(result)
+	}
+	if err != nil {
+		reqLog.EndTime = time.Now()
+		reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+		reqLog.StatusCode = http.StatusInternalServerError
+		reqLog.Error = fmt.Sprintf("响应体转换失败: %v", err)
+		logger.LogRequest(reqLog)
+
+		c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": reqLog.Error,
+		})
+		return
+	}
+
+	header := http.Header{"Content-Type": []string{"application/json; charset=utf-8"}}
+	copyResponseHeaders(c, transformResponseHeader(header, rule, vars))
+	c.Status(http.StatusOK)
+	c.Response.SetBody(out)
+
+	capture := newBodyCapture(maxBodySize)
+	capture.Write(out)
+	reqLog.EndTime = time.Now()
+	reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+	reqLog.StatusCode = http.StatusOK
+	reqLog.ResponseBody = capture.Format(header.Get("Content-Type"))
+	logger.LogRequest(reqLog)
+}
+
+// runCompositeCall 等待依赖的子请求完成后执行子请求，依赖失败时跳过
+func (p *ProxyMiddleware) runCompositeCall(ctx context.Context, run *compositeRequest, call *compositeCall) error {
+	for _, name := range call.call.Dependencies() {
+		dep := run.calls[name]
+		<-dep.done
+		if dep.err != nil {
+			return fmt.Errorf("依赖的子请求 %q 失败", name)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("聚合请求已取消: %w", err)
+	}
+	return p.doCompositeCall(ctx, run, call)
+}
+
+// doCompositeCall 发送子请求，读取并解析 JSON 响应体，执行子请求的转换步骤
+// 子请求与普通转发共用连接池、健康检查和熔断器，状态码不是 2xx 时视为失败
+func (p *ProxyMiddleware) doCompositeCall(ctx context.Context, run *compositeRequest, call *compositeCall) error {
+	rule, cfg, callLog := run.rule, call.call, call.log
+	target := cfg.Target
+
+	uri := cfg.RenderPath(run.lookup)
+	callLog.Path, callLog.Query, _ = strings.Cut(uri, "?")
+	body := cfg.RenderBody(run.jsonLookup)
+	requestCapture := newBodyCapture(run.maxBodySize)
+	requestCapture.Write([]byte(body))
+
+	header := make(http.Header)
+	run.vars.client.setForwardingHeaders(header)
+	for key, value := range rule.Headers {
+		header.Set(key, value)
+	}
+	for key := range cfg.Headers {
+		if value := cfg.RenderHeader(key, run.lookup); value != "" {
+			header.Set(key, value)
+		}
+	}
+	if body != "" && header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json")
+	}
+	callLog.Headers = make(map[string]string, len(header))
+	for key := range header {
+		callLog.Headers[key] = header.Get(key)
+	}
+	callLog.Body = requestCapture.Format(header.Get("Content-Type"))
+
+	if p.balancer.isDrained(target) {
+		return fmt.Errorf("上游目标 %s 已摘除", target)
+	}
+	if !p.health.isHealthy(target) {
+		return errNoHealthyTarget
+	}
+
+	timeout := ruleTimeout(rule)
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Millisecond
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(callCtx, cfg.RequestMethod(), buildTargetURL(target, uri), strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header = header
+
+	transport, err := p.transports.get(target, rule)
+	if err != nil {
+		return err
+	}
+	done, probe, ok := p.balancer.acquire(rule, target)
+	if !ok {
+		return errNoHealthyTarget
+	}
+	defer done()
+
+	start := time.Now()
+	resp, err := transport.do(req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.Canceled) {
+			// 其他子请求失败或客户端断开导致的取消，不是上游的问题，不记录结果
+			return fmt.Errorf("聚合请求已取消: %w", err)
+		}
+		p.health.report(target, rule.HealthCheck, false, err.Error())
+		p.breakers.record(target, rule.Breaker, probe, false, time.Since(start))
+		if errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%w: %v", errUpstreamTimeout, err)
+		}
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	success := !isFailureStatus(resp.StatusCode)
+	p.health.report(target, rule.HealthCheck, success, fmt.Sprintf("上游返回状态码 %d", resp.StatusCode))
+	p.breakers.record(target, rule.Breaker, probe, success, time.Since(start))
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTransformBodySize+1))
+	callLog.StatusCode = resp.StatusCode
+	responseCapture := newBodyCapture(run.maxBodySize)
+	responseCapture.Write(data)
+	callLog.ResponseBody = responseCapture.Format(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+	if len(data) > maxTransformBodySize {
+		return fmt.Errorf("响应体%w（%d 字节）", errBodyTooLarge, maxTransformBodySize)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("上游返回状态码 %d", resp.StatusCode)
+	}
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		if data, err = gunzip(data); err != nil {
+			return err
+		}
+	}
+
+	var value interface{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if value, err = decodeJSON(data); err != nil {
+			return fmt.Errorf("解析 JSON 失败: %w", err)
+		}
+	}
+	if len(cfg.Steps) > 0 {
+		templateData := map[string]interface{}{
+			"status":  resp.StatusCode,
+			"request": run.requestData,
+		}
+		if value, err = applyBodyTransformSteps(value, cfg.Steps, templateData); err != nil {
+			return err
+		}
+	}
+	if _, ok := value.(map[string]interface{}); !ok && cfg.ResultPath() == config.CompositeAsRoot {
+		return fmt.Errorf("合并到顶层的结果不是 JSON 对象")
+	}
+
+	raw, err := encodeJSON(value)
+	if err != nil {
+		return err
+	}
+	call.value, call.raw = value, raw
+	return nil
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// 调试模式使用的请求头和响应头
+const (
+	debugRequestHeader     = "X-BFF-Debug"        // 请求带有该请求头并且携带管理后台 Cookie 时开启调试模式
+	debugRequestIDHeader   = "X-BFF-Request-Id"   // 请求 ID，与日志中的 request_id 相同
+	debugRuleHeader        = "X-BFF-Rule"         // 生效的规则
+	debugTargetHeader      = "X-BFF-Target"       // 选择的上游目标
+	debugUpstreamURIHeader = "X-BFF-Upstream-Uri" // 转发给上游的路径和查询参数
+	debugExplainHeader     = "X-BFF-Explain"      // 每个没有生效的规则一行，说明不满足的条件
+)
+
+// maxDebugExplain 调试模式最多说明的规则数量，避免响应头过大
+const maxDebugExplain = 50
+
+// newRequestID 生成请求 ID
+func newRequestID() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
+
+// isDebugRequest 判断是否开启调试模式：请求带有调试请求头，并且携带管理后台的 Cookie
+// 没有 Cookie 时忽略调试请求头，不暴露代理信息
+func isDebugRequest(c *app.RequestContext, cfg *config.Config) bool {
+	if len(c.Request.Header.Peek(debugRequestHeader)) == 0 {
+		return false
+	}
+	key, value := cfg.AdminAuth.Cookie()
+	return string(c.Cookie(key)) == value
+}
+
+// explainRules 说明每个没有生效的规则的原因，与 findMatchingRule 使用相同的匹配逻辑
+// 满足条件但没有生效的规则（优先级或具体程度不如 matched）也会列出
+func (p *ProxyMiddleware) explainRules(c *app.RequestContext, cfg *config.Config, body *requestBody, matched *config.ProxyRule) []string {
+	var reasons []string
+	order := cfg.Proxy.RuleOrder()
+	for n, i := range order {
+		if len(reasons) == maxDebugExplain {
+			reasons = append(reasons, fmt.Sprintf("... 还有 %d 个规则没有列出", len(order)-n))
+			break
+		}
+
+		rule := &cfg.Proxy.Rules[i]
+		if rule == matched {
+			continue
+		}
+		var why string
+		if _, ok := p.matchCondition(c, &rule.Match, body, &why); ok {
+			if matched == nil {
+				// 路由表没有把该规则列为候选，与逐个匹配的结果不一致
+				why = "条件满足，但路由表没有选中任何规则（路由表与匹配条件不一致）"
+			} else {
+				why = fmt.Sprintf("条件满足，但规则 %s 优先生效", matched.Name)
+			}
+		}
+		reasons = append(reasons, rule.Name+": "+why)
+	}
+	return reasons
+}
+
+// setDebugHeader 设置调试响应头，去掉值中的换行
+func setDebugHeader(c *app.RequestContext, key, value string) {
+	c.Response.Header.Set(key, sanitizeHeaderValue(value))
+}
+
+// addDebugHeader 添加调试响应头，去掉值中的换行
+func addDebugHeader(c *app.RequestContext, key, value string) {
+	c.Response.Header.Add(key, sanitizeHeaderValue(value))
+}
+
+// sanitizeHeaderValue 把控制字符替换为空格，避免拆分响应头
+func sanitizeHeaderValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, value)
+}
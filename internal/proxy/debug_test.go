@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// TestExplainRules 调试模式说明每个没有生效的规则的原因
+func TestExplainRules(t *testing.T) {
+	cfg := loadTestConfig(t, `proxy:
+  rules:
+    - name: users
+      match:
+        path: /api/users
+        method: POST
+      target: http://127.0.0.1:8080
+    - name: api
+      match:
+        path: /api
+      target: http://127.0.0.1:8080
+    - name: beta
+      priority: 10
+      match:
+        path: /api
+        headers:
+          X-Env: beta
+      target: http://127.0.0.1:8080
+`)
+	p := &ProxyMiddleware{}
+	explain := func(uri string, headers map[string]string) (*config.ProxyRule, []string) {
+		c := app.NewContext(0)
+		c.Request.Header.SetMethod("GET")
+		c.Request.SetRequestURI(uri)
+		for key, value := range headers {
+			c.Request.Header.Set(key, value)
+		}
+		rule, _ := p.findMatchingRule(c, cfg, newRequestBody(c))
+		return rule, p.explainRules(c, cfg, newRequestBody(c), rule)
+	}
+
+	t.Run("没有匹配的规则", func(t *testing.T) {
+		rule, reasons := explain("/other", nil)
+		if rule != nil {
+			t.Fatalf("匹配到规则 %s", rule.Name)
+		}
+		want := []string{
+			"beta: 路径不匹配 /api",
+			"users: 路径不匹配 /api/users",
+			"api: 路径不匹配 /api",
+		}
+		if !slices.Equal(reasons, want) {
+			t.Errorf("got %q, want %q", reasons, want)
+		}
+	})
+
+	t.Run("被高优先级规则覆盖", func(t *testing.T) {
+		rule, reasons := explain("/api/users", map[string]string{"X-Env": "beta"})
+		if rule == nil || rule.Name != "beta" {
+			t.Fatalf("匹配到规则 %v，期望 beta", rule)
+		}
+		want := []string{
+			"users: 方法不是 POST",
+			"api: 条件满足，但规则 beta 优先生效",
+		}
+		if !slices.Equal(reasons, want) {
+			t.Errorf("got %q, want %q", reasons, want)
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// writeFallback 返回兜底响应，返回状态码和用于日志记录的响应体
+func writeFallback(c *app.RequestContext, fallback *config.FallbackResponse) (int, string) {
+	statusCode := fallback.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	// 未配置 Content-Type 时默认返回 JSON
+	c.Response.Header.SetContentType("application/json; charset=utf-8")
+	for key, value := range fallback.Headers {
+		c.Response.Header.Set(key, value)
+	}
+	c.Status(statusCode)
+	c.Response.SetBodyString(fallback.Body)
+
+	return statusCode, fallback.Body
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// clientConn 客户端连接信息，按受信任的代理解析转发链，用于生成转发请求头和 {client_ip}
+type clientConn struct {
+	ip        string   // 客户端 IP：转发链中从右往左第一个不受信任的地址
+	peer      string   // 直接连接的对端地址
+	chain     []string // 对端受信任时，已有的 X-Forwarded-For 地址
+	forwarded []string // 对端受信任时，已有的 Forwarded 元素
+	proto     string   // 客户端使用的协议
+	host      string   // 客户端请求的 Host
+
+	forwarding *config.ForwardingConfig
+}
+
+// newClientConn 解析客户端连接信息，remoteAddr 为直接连接的对端地址
+// 内置的 HTTPS、h2c 监听通过本机回环地址转发请求，这一跳不计入转发链：
+// 对端是回环地址并且带有监听添加的内部转发令牌时，以 X-Forwarded-For 的最后一个地址作为对端，协议和 Host 使用监听添加的请求头；
+// 没有令牌的回环请求（如本机的其他进程）按普通对端处理，只有配置在 trusted_proxies 中才采用转发请求头
+func newClientConn(c *app.RequestContext, remoteAddr string, forwarding *config.ForwardingConfig) *clientConn {
+	conn := &clientConn{
+		peer:       remoteAddr,
+		proto:      "http",
+		host:       string(c.Host()),
+		forwarding: forwarding,
+	}
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		conn.peer = host
+	}
+
+	chain := splitHeaderList(c.Request.Header.GetAll(config.ForwardedFor))
+	proto := string(c.Request.Header.Peek(config.ForwardedProto))
+	host := string(c.Request.Header.Peek(config.ForwardedHost))
+	// 令牌校验后删除，不记录日志也不转发给上游
+	hop := string(c.Request.Header.Peek(config.InternalHopHeader))
+	c.Request.Header.Del(config.InternalHopHeader)
+	internal := hop != "" && subtle.ConstantTimeCompare([]byte(hop), []byte(config.InternalHopToken())) == 1
+	if ip := net.ParseIP(conn.peer); ip != nil && ip.IsLoopback() && internal && len(chain) > 0 {
+		conn.peer, chain = chain[len(chain)-1], chain[:len(chain)-1]
+		if proto != "" {
+			conn.proto = proto
+		}
+		if host != "" {
+			conn.host = host
+		}
+	}
+
+	// 只有受信任的代理添加的转发请求头才可信
+	if conn.trusted(conn.peer) {
+		conn.chain = chain
+		conn.forwarded = splitHeaderList(c.Request.Header.GetAll(config.Forwarded))
+		if proto != "" {
+			conn.proto = proto
+		}
+		if host != "" {
+			conn.host = host
+		}
+	}
+
+	// 从右往左跳过受信任的代理，全部受信任时取最左边的地址
+	conn.ip = conn.peer
+	for i := len(conn.chain) - 1; i >= 0 && conn.trusted(conn.ip); i-- {
+		conn.ip = conn.chain[i]
+	}
+	return conn
+}
+
+// trusted 判断地址是否是受信任的代理
+func (conn *clientConn) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && conn.forwarding.Trusted(ip)
+}
+
+// setForwardingHeaders 设置转发请求头
+// 对端不受信任时先删除客户端自带的转发请求头，避免伪造；受信任时保留未配置添加的转发请求头
+func (conn *clientConn) setForwardingHeaders(header http.Header) {
+	trusted := conn.trusted(conn.peer)
+	for _, key := range config.ForwardingHeaders {
+		if !trusted || conn.forwarding.Enabled(key) {
+			header.Del(key)
+		}
+	}
+
+	if conn.forwarding.Enabled(config.ForwardedFor) {
+		header.Set(config.ForwardedFor, strings.Join(append(slices.Clone(conn.chain), conn.peer), ", "))
+	}
+	if conn.forwarding.Enabled(config.ForwardedProto) {
+		header.Set(config.ForwardedProto, conn.proto)
+	}
+	if conn.forwarding.Enabled(config.ForwardedHost) && conn.host != "" {
+		header.Set(config.ForwardedHost, conn.host)
+	}
+	if conn.forwarding.Enabled(config.RealIP) {
+		header.Set(config.RealIP, conn.ip)
+	}
+	if conn.forwarding.Enabled(config.Forwarded) {
+		element := "for=" + forwardedNode(conn.peer) + ";proto=" + conn.proto
+		if conn.host != "" {
+			element += ";host=" + forwardedValue(conn.host)
+		}
+		header.Set(config.Forwarded, strings.Join(append(slices.Clone(conn.forwarded), element), ", "))
+	}
+}
+
+// splitHeaderList 拆分逗号分隔的请求头，可能有多行
+func splitHeaderList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// forwardedNode 返回 Forwarded 中的节点地址，IPv6 地址需要加方括号和引号
+func forwardedNode(addr string) string {
+	if strings.Contains(addr, ":") {
+		return `"[` + addr + `]"`
+	}
+	return addr
+}
+
+// forwardedValue 返回 Forwarded 中的参数值，包含 token 以外的字符（如端口前的冒号）时加引号
+func forwardedValue(value string) string {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0) {
+			return `"` + strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), `"`, `\"`) + `"`
+		}
+	}
+	return value
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// TestNewClientConn 回环地址只有带着内部转发令牌或配置为受信任的代理时才采用转发请求头
+func TestNewClientConn(t *testing.T) {
+	tests := []struct {
+		name      string
+		remote    string
+		headers   map[string]string
+		trusted   []string
+		wantIP    string
+		wantPeer  string
+		wantHost  string
+		wantProto string
+	}{
+		{
+			name:      "直接连接",
+			remote:    "203.0.113.7:5000",
+			headers:   map[string]string{config.ForwardedFor: "6.6.6.6", config.ForwardedHost: "evil"},
+			wantIP:    "203.0.113.7",
+			wantPeer:  "203.0.113.7",
+			wantHost:  "example.com",
+			wantProto: "http",
+		},
+		{
+			name:      "本机进程伪造转发请求头",
+			remote:    "127.0.0.1:5000",
+			headers:   map[string]string{config.ForwardedFor: "6.6.6.6", config.ForwardedProto: "https", config.ForwardedHost: "evil"},
+			wantIP:    "127.0.0.1",
+			wantPeer:  "127.0.0.1",
+			wantHost:  "example.com",
+			wantProto: "http",
+		},
+		{
+			name:      "伪造内部转发令牌",
+			remote:    "127.0.0.1:5000",
+			headers:   map[string]string{config.ForwardedFor: "6.6.6.6", config.InternalHopHeader: "guess"},
+			wantIP:    "127.0.0.1",
+			wantPeer:  "127.0.0.1",
+			wantHost:  "example.com",
+			wantProto: "http",
+		},
+		{
+			name:   "内置监听转发",
+			remote: "127.0.0.1:5000",
+			headers: map[string]string{
+				config.ForwardedFor:      "198.51.100.1",
+				config.ForwardedProto:    "https",
+				config.ForwardedHost:     "api.example.com",
+				config.InternalHopHeader: config.InternalHopToken(),
+			},
+			wantIP:    "198.51.100.1",
+			wantPeer:  "198.51.100.1",
+			wantHost:  "api.example.com",
+			wantProto: "https",
+		},
+		{
+			name:      "回环地址配置为受信任的代理",
+			remote:    "127.0.0.1:5000",
+			headers:   map[string]string{config.ForwardedFor: "198.51.100.1", config.ForwardedProto: "https"},
+			trusted:   []string{"127.0.0.1"},
+			wantIP:    "198.51.100.1",
+			wantPeer:  "127.0.0.1",
+			wantHost:  "example.com",
+			wantProto: "https",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yaml := "proxy:\n  rules: []\n"
+			if len(tt.trusted) > 0 {
+				yaml += "  forwarding:\n    trusted_proxies: [" + strings.Join(tt.trusted, ", ") + "]\n"
+			}
+			cfg := loadTestConfig(t, yaml)
+
+			c := app.NewContext(0)
+			c.Request.SetRequestURI("/")
+			c.Request.SetHost("example.com")
+			for key, value := range tt.headers {
+				c.Request.Header.Set(key, value)
+			}
+
+			conn := newClientConn(c, tt.remote, &cfg.Proxy.Forwarding)
+			if conn.ip != tt.wantIP || conn.peer != tt.wantPeer || conn.host != tt.wantHost || conn.proto != tt.wantProto {
+				t.Errorf("got ip=%s peer=%s host=%s proto=%s, want ip=%s peer=%s host=%s proto=%s",
+					conn.ip, conn.peer, conn.host, conn.proto, tt.wantIP, tt.wantPeer, tt.wantHost, tt.wantProto)
+			}
+			if len(c.Request.Header.Peek(config.InternalHopHeader)) > 0 {
+				t.Errorf("内部转发令牌没有删除")
+			}
+		})
+	}
+}
+
+// loadTestConfig 从 YAML 加载并编译配置
+func loadTestConfig(t *testing.T, yaml string) *config.Config {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
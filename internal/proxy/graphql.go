@@ -0,0 +1,360 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// graphqlOperation 从 GraphQL 请求中解析出的操作
+type graphqlOperation struct {
+	Name   string   // 操作名，匿名操作为空
+	Type   string   // query、mutation、subscription
+	Fields []string // 顶层字段（不含别名，包括片段中的字段）
+}
+
+// parseGraphQLRequest 解析 GraphQL 请求
+// POST 请求体为 JSON（{"query": ..., "operationName": ...}，批量请求取第一个）或 application/graphql，
+// GET 请求从 query、operationName 参数读取；只有 operationName 没有 query 时（持久化查询）只返回操作名
+func parseGraphQLRequest(body *requestBody) (*graphqlOperation, bool) {
+	var query, operationName string
+	if data := body.Peek(); len(data) > 0 {
+		if strings.HasPrefix(body.contentType, "application/graphql") {
+			query = string(data)
+		} else {
+			doc := body.JSON()
+			if doc.IsArray() {
+				doc = doc.Get("0")
+			}
+			if !doc.IsObject() {
+				return nil, false
+			}
+			query = doc.Get("query").String()
+			operationName = doc.Get("operationName").String()
+		}
+	} else if body.query != nil {
+		query = string(body.query.Peek("query"))
+		operationName = string(body.query.Peek("operationName"))
+	}
+
+	if query == "" {
+		if operationName == "" {
+			return nil, false
+		}
+		return &graphqlOperation{Name: operationName}, true
+	}
+	return parseGraphQL(query, operationName)
+}
+
+// parseGraphQL 解析 GraphQL 文档，返回要执行的操作
+// 文档中有多个操作时按 operationName 选择，只有一个操作时直接使用
+func parseGraphQL(query, operationName string) (*graphqlOperation, bool) {
+	p := &graphqlParser{tokens: lexGraphQL(query)}
+	var operations []*graphqlOperation
+	fragments := make(map[string]*graphqlSelection)
+
+	for !p.done() {
+		token := p.next()
+		switch token {
+		case "{":
+			// 简写的匿名查询
+			op := &graphqlOperation{Type: "query"}
+			operations = append(operations, op)
+			p.pending = append(p.pending, pendingOperation{op, p.selectionSet()})
+		case "query", "mutation", "subscription":
+			op := &graphqlOperation{Type: token}
+			if p.peek() != "(" && p.peek() != "@" && p.peek() != "{" {
+				op.Name = p.next()
+			}
+			p.skipBalanced("(", ")")
+			p.skipDirectives()
+			if p.next() != "{" {
+				return nil, false
+			}
+			operations = append(operations, op)
+			p.pending = append(p.pending, pendingOperation{op, p.selectionSet()})
+		case "fragment":
+			name := p.next()
+			if p.next() != "on" {
+				return nil, false
+			}
+			p.next() // 类型条件
+			p.skipDirectives()
+			if p.next() != "{" {
+				return nil, false
+			}
+			fragments[name] = p.selectionSet()
+		default:
+			return nil, false
+		}
+		if p.failed {
+			return nil, false
+		}
+	}
+
+	// 片段可以定义在操作之后，全部解析完再展开
+	for _, pending := range p.pending {
+		pending.op.Fields = pending.selection.resolve(fragments, make(map[string]bool))
+	}
+
+	switch {
+	case operationName != "":
+		for _, op := range operations {
+			if op.Name == operationName {
+				return op, true
+			}
+		}
+		return nil, false
+	case len(operations) == 1:
+		return operations[0], true
+	default:
+		return nil, false
+	}
+}
+
+// graphqlSelection 选择集中的顶层字段和片段引用
+type graphqlSelection struct {
+	fields    []string
+	fragments []string
+}
+
+// resolve 展开片段引用，返回去重后的顶层字段，visiting 用于防止片段循环引用
+func (s *graphqlSelection) resolve(fragments map[string]*graphqlSelection, visiting map[string]bool) []string {
+	fields := append([]string(nil), s.fields...)
+	for _, name := range s.fragments {
+		fragment, ok := fragments[name]
+		if !ok || visiting == nil || visiting[name] {
+			continue
+		}
+		visiting[name] = true
+		fields = append(fields, fragment.resolve(fragments, visiting)...)
+		delete(visiting, name)
+	}
+
+	seen := make(map[string]bool, len(fields))
+	unique := fields[:0]
+	for _, field := range fields {
+		if !seen[field] {
+			seen[field] = true
+			unique = append(unique, field)
+		}
+	}
+	return unique
+}
+
+// pendingOperation 等待展开片段的操作
+type pendingOperation struct {
+	op        *graphqlOperation
+	selection *graphqlSelection
+}
+
+// graphqlParser 只解析路由需要的部分：操作类型、操作名和顶层字段
+type graphqlParser struct {
+	tokens  []string
+	pos     int
+	failed  bool
+	pending []pendingOperation
+}
+
+// done 是否已经读完所有记号
+func (p *graphqlParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+// peek 返回下一个记号但不移动位置
+func (p *graphqlParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// next 读取下一个记号，已经读完时标记解析失败
+func (p *graphqlParser) next() string {
+	if p.done() {
+		p.failed = true
+		return ""
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+// skipBalanced 下一个记号是 open 时跳过到匹配的 close
+func (p *graphqlParser) skipBalanced(open, close string) {
+	if p.peek() != open {
+		return
+	}
+	depth := 0
+	for !p.done() {
+		switch p.next() {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+	p.failed = true
+}
+
+// skipDirectives 跳过 @name(args) 形式的指令
+func (p *graphqlParser) skipDirectives() {
+	for p.peek() == "@" {
+		p.next()
+		p.next()
+		p.skipBalanced("(", ")")
+	}
+}
+
+// selectionSet 解析选择集（已读取 {），只记录顶层字段，嵌套的选择集整体跳过
+func (p *graphqlParser) selectionSet() *graphqlSelection {
+	selection := &graphqlSelection{}
+	for !p.done() {
+		token := p.next()
+		switch token {
+		case "}":
+			return selection
+		case "...":
+			if p.peek() == "on" || p.peek() == "@" || p.peek() == "{" {
+				// 内联片段的字段属于同一层
+				if p.peek() == "on" {
+					p.next()
+					p.next()
+				}
+				p.skipDirectives()
+				if p.next() != "{" {
+					p.failed = true
+					return selection
+				}
+				inline := p.selectionSet()
+				selection.fields = append(selection.fields, inline.fields...)
+				selection.fragments = append(selection.fragments, inline.fragments...)
+				continue
+			}
+			selection.fragments = append(selection.fragments, p.next())
+			p.skipDirectives()
+		default:
+			field := token
+			if p.peek() == ":" {
+				// 别名
+				p.next()
+				field = p.next()
+			}
+			if field == "" || !isGraphQLNameStart(field[0]) {
+				p.failed = true
+				return selection
+			}
+			selection.fields = append(selection.fields, field)
+			p.skipBalanced("(", ")")
+			p.skipDirectives()
+			p.skipBalanced("{", "}")
+		}
+	}
+	p.failed = true
+	return selection
+}
+
+// lexGraphQL 把 GraphQL 文档切分为记号，忽略空白、逗号、注释，字符串整体作为一个记号
+func lexGraphQL(source string) []string {
+	source = strings.TrimPrefix(source, "\ufeff")
+	var tokens []string
+	for i := 0; i < len(source); {
+		c := source[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+			continue
+		case c == '#':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+			continue
+		case strings.HasPrefix(source[i:], "..."):
+			i += 3
+		case strings.HasPrefix(source[i:], `"""`):
+			// 块字符串中 \""" 是转义，不结束字符串
+			i += 3
+			for i < len(source) && !strings.HasPrefix(source[i:], `"""`) {
+				if strings.HasPrefix(source[i:], `\"""`) {
+					i += 3
+				}
+				i++
+			}
+			i = min(i+3, len(source))
+		case c == '"':
+			i++
+			for i < len(source) && source[i] != '"' {
+				if source[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i = min(i+1, len(source))
+		case c == '-' || (c >= '0' && c <= '9'):
+			i++
+			for i < len(source) && strings.IndexByte("0123456789.eE+-", source[i]) >= 0 {
+				i++
+			}
+		case isGraphQLNameStart(c):
+			i++
+			for i < len(source) && (isGraphQLNameStart(source[i]) || (source[i] >= '0' && source[i] <= '9')) {
+				i++
+			}
+		default:
+			i++
+		}
+		tokens = append(tokens, source[start:i])
+	}
+	return tokens
+}
+
+// isGraphQLNameStart 是否可以作为名称的第一个字符
+func isGraphQLNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// graphqlLogOperation 返回请求日志中记录的 GraphQL 操作，不是 GraphQL 请求时返回空字符串
+// 匹配时解析过的请求直接使用解析结果；没有解析过时，只在请求看起来是 GraphQL 请求时解析：
+// 带有 query 或 operationName 参数的 GET 请求、application/graphql 请求体，
+// 以及路径以 /graphql 结尾或者已经为 Body 匹配预读过的 JSON 请求体
+func graphqlLogOperation(c *app.RequestContext, body *requestBody) string {
+	op := body.parsedGraphQL()
+	if op == nil && looksLikeGraphQL(c, body) {
+		op = body.GraphQL()
+	}
+	if op == nil {
+		return ""
+	}
+	return graphqlOperationLabel(op)
+}
+
+// looksLikeGraphQL 判断请求是否可能是 GraphQL 请求，避免为普通请求预读请求体
+func looksLikeGraphQL(c *app.RequestContext, body *requestBody) bool {
+	switch string(c.Method()) {
+	case "GET":
+		return body.query != nil && (len(body.query.Peek("query")) > 0 || len(body.query.Peek("operationName")) > 0)
+	case "POST":
+		if strings.HasPrefix(body.contentType, "application/graphql") {
+			return true
+		}
+		if !strings.HasPrefix(body.contentType, "application/json") {
+			return false
+		}
+		return body.didPeek || strings.HasSuffix(strings.TrimSuffix(string(c.Path()), "/"), "/graphql")
+	}
+	return false
+}
+
+// graphqlOperationLabel 日志中显示的操作，如 "query GetUser"
+func graphqlOperationLabel(op *graphqlOperation) string {
+	if op.Type == "" {
+		return op.Name
+	}
+	if op.Name == "" {
+		return op.Type
+	}
+	return op.Type + " " + op.Name
+}
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// TestLexGraphQL 记号切分：忽略空白、逗号和注释，字符串和块字符串整体作为一个记号
+func TestLexGraphQL(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"简单查询", `query { user }`, []string{"query", "{", "user", "}"}},
+		{"逗号和注释", "{ a, b # c }\n d }", []string{"{", "a", "b", "d", "}"}},
+		{"BOM", "\ufeff{ a }", []string{"{", "a", "}"}},
+		{"片段展开", `{ ...UserFields ... on User { id } }`, []string{"{", "...", "UserFields", "...", "on", "User", "{", "id", "}", "}"}},
+		{"别名和参数", `{ u: user(id: $id, n: -1.5e+3) }`, []string{"{", "u", ":", "user", "(", "id", ":", "$", "id", "n", ":", "-1.5e+3", ")", "}"}},
+		{"字符串中的转义和括号", `{ a(s: "x\"}{ #") }`, []string{"{", "a", "(", "s", ":", `"x\"}{ #"`, ")", "}"}},
+		{"块字符串", "{ a(s: \"\"\"\n}\n# \"x\" {\n\"\"\") }", []string{"{", "a", "(", "s", ":", "\"\"\"\n}\n# \"x\" {\n\"\"\"", ")", "}"}},
+		{"块字符串中的转义", `{ a(s: """x \""" }""") }`, []string{"{", "a", "(", "s", ":", `"""x \""" }"""`, ")", "}"}},
+		{"未结束的块字符串", `{ a(s: """x`, []string{"{", "a", "(", "s", ":", `"""x`}},
+		{"指令", `{ a @include(if: true) }`, []string{"{", "a", "@", "include", "(", "if", ":", "true", ")", "}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lexGraphQL(tt.source); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseGraphQL 解析操作类型、操作名和顶层字段，ok 为 false 时期望解析失败
+func TestParseGraphQL(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		ok            bool
+		wantName      string
+		wantType      string
+		wantFields    []string
+	}{
+		{name: "简写的匿名查询", query: `{ user { id } orders }`, ok: true, wantType: "query", wantFields: []string{"user", "orders"}},
+		{name: "命名查询和变量", query: `query GetUser($id: ID! = "1") { user(id: $id) { id name } }`, ok: true, wantName: "GetUser", wantType: "query", wantFields: []string{"user"}},
+		{name: "匿名的 mutation", query: `mutation($input: OrderInput = {items: [{sku: "a"}]}) { createOrder(input: $input) { id } }`, ok: true, wantType: "mutation", wantFields: []string{"createOrder"}},
+		{name: "subscription", query: `subscription OnOrder { orderCreated { id } }`, ok: true, wantName: "OnOrder", wantType: "subscription", wantFields: []string{"orderCreated"}},
+		{name: "别名取字段名", query: `{ a: user(id: 1) { id } b: user(id: 2) { id } c: orders }`, ok: true, wantType: "query", wantFields: []string{"user", "orders"}},
+		{name: "片段展开", query: `query Q { ...Fields viewer } fragment Fields on Query { user { id } orders }`, ok: true, wantName: "Q", wantType: "query", wantFields: []string{"viewer", "user", "orders"}},
+		{name: "嵌套的片段", query: `fragment A on Query { a ...B } fragment B on Query { b } { ...A }`, ok: true, wantType: "query", wantFields: []string{"a", "b"}},
+		{name: "片段循环引用", query: `{ ...A } fragment A on Query { a ...B } fragment B on Query { b ...A }`, ok: true, wantType: "query", wantFields: []string{"a", "b"}},
+		{name: "未定义的片段", query: `{ a ...Missing }`, ok: true, wantType: "query", wantFields: []string{"a"}},
+		{name: "内联片段", query: `{ ... on Query { user } ... @include(if: $x) { orders } ... { viewer } }`, ok: true, wantType: "query", wantFields: []string{"user", "orders", "viewer"}},
+		{name: "指令", query: `query Q @cached(ttl: 60) { user @skip(if: $x) { id } ...F @include(if: true) } fragment F on Query @dir { orders }`, ok: true, wantName: "Q", wantType: "query", wantFields: []string{"user", "orders"}},
+		{name: "参数中的字符串和块字符串", query: "{ search(q: \"} {\", doc: \"\"\"\n} mutation {\n\"\"\") { id } orders }", ok: true, wantType: "query", wantFields: []string{"search", "orders"}},
+		{name: "重复的字段去重", query: `{ user { id } user { name } ... on Query { user } }`, ok: true, wantType: "query", wantFields: []string{"user"}},
+		{name: "按 operationName 选择", query: `query A { a } mutation B { b } query C { ...F } fragment F on Query { c }`, operationName: "C", ok: true, wantName: "C", wantType: "query", wantFields: []string{"c"}},
+		{name: "按 operationName 选择 mutation", query: `query A { a } mutation B { b }`, operationName: "B", ok: true, wantName: "B", wantType: "mutation", wantFields: []string{"b"}},
+		{name: "只有一个操作时忽略 operationName", query: `query A { a }`, ok: true, wantName: "A", wantType: "query", wantFields: []string{"a"}},
+		{name: "多个操作没有 operationName", query: `query A { a } query B { b }`},
+		{name: "operationName 不存在", query: `query A { a } query B { b }`, operationName: "C"},
+		{name: "选择集没有结束", query: `query A { user { id }`},
+		{name: "参数没有结束", query: `{ user(id: 1 }`},
+		{name: "片段缺少类型条件", query: `{ ...F } fragment F { a }`},
+		{name: "不是 GraphQL", query: `{"query": "{ a }"}`},
+		{name: "未知的定义", query: `schema { query: Query }`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, ok := parseGraphQL(tt.query, tt.operationName)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v (op = %+v)", ok, tt.ok, op)
+			}
+			if !ok {
+				return
+			}
+			if op.Name != tt.wantName || op.Type != tt.wantType || !slices.Equal(op.Fields, tt.wantFields) {
+				t.Errorf("got %s %q %q, want %s %q %q", op.Type, op.Name, op.Fields, tt.wantType, tt.wantName, tt.wantFields)
+			}
+		})
+	}
+}
+
+// TestParseGraphQLRequest 从 JSON、application/graphql 请求体和 GET 参数中读取查询
+func TestParseGraphQLRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		uri         string
+		body        string
+		ok          bool
+		want        string
+	}{
+		{name: "JSON", contentType: "application/json", uri: "/graphql", body: `{"query": "query A { a } query B { b }", "operationName": "B"}`, ok: true, want: "query B"},
+		{name: "批量请求取第一个", contentType: "application/json", uri: "/graphql", body: `[{"query": "mutation M { m }"}, {"query": "{ a }"}]`, ok: true, want: "mutation M"},
+		{name: "application/graphql", contentType: "application/graphql; charset=utf-8", uri: "/graphql", body: `query A { a }`, ok: true, want: "query A"},
+		{name: "GET 参数", uri: "/graphql?query=query%20A%20%7B%20a%20%7D", ok: true, want: "query A"},
+		{name: "持久化查询只有操作名", uri: "/graphql?operationName=GetUser&extensions=%7B%7D", ok: true, want: "GetUser"},
+		{name: "请求体不是对象", contentType: "application/json", uri: "/graphql", body: `"query"`},
+		{name: "没有查询", uri: "/graphql"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := app.NewContext(0)
+			c.Request.SetRequestURI(tt.uri)
+			body := &requestBody{
+				stream:        bytes.NewReader([]byte(tt.body)),
+				contentLength: len(tt.body),
+				contentType:   tt.contentType,
+				query:         c.QueryArgs(),
+			}
+
+			op, ok := parseGraphQLRequest(body)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && graphqlOperationLabel(op) != tt.want {
+				t.Errorf("got %q, want %q", graphqlOperationLabel(op), tt.want)
+			}
+		})
+	}
+}
+
+// TestGraphQLLogOperation 没有配置 graphql 匹配条件的规则也在日志中记录操作名，普通请求不预读请求体
+func TestGraphQLLogOperation(t *testing.T) {
+	cfg := loadTestConfig(t, `proxy:
+  rules:
+    - name: graphql
+      match:
+        path: /graphql
+      target: http://127.0.0.1:8080
+    - name: api
+      match:
+        path: /api
+      target: http://127.0.0.1:8080
+`)
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		uri         string
+		body        string
+		want        string
+		wantPeek    bool
+	}{
+		{"JSON", "POST", "application/json", "/graphql", `{"query": "query GetUser { user { id } }"}`, "query GetUser", true},
+		{"GET 参数", "GET", "", "/graphql?query=mutation%20M%20%7B%20m%20%7D", "", "mutation M", true},
+		{"application/graphql", "POST", "application/graphql", "/api/gql", `query A { a }`, "query A", true},
+		{"普通 JSON 请求", "POST", "application/json", "/api/users", `{"query": "query A { a }"}`, "", false},
+		{"普通 GET 请求", "GET", "", "/api/users?page=1", "", "", false},
+	}
+	p := &ProxyMiddleware{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := app.NewContext(0)
+			c.Request.Header.SetMethod(tt.method)
+			c.Request.SetRequestURI(tt.uri)
+			if tt.contentType != "" {
+				c.Request.Header.SetContentTypeBytes([]byte(tt.contentType))
+			}
+			body := benchmarkBody(c, []byte(tt.body))
+			if rule, _ := p.findMatchingRule(c, cfg, body); rule == nil {
+				t.Fatal("没有匹配的规则")
+			}
+			if body.parsedGraphQL() != nil {
+				t.Fatal("匹配时不应该解析 GraphQL")
+			}
+
+			if got := graphqlLogOperation(c, body); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if body.didPeek != tt.wantPeek {
+				t.Errorf("didPeek = %v, want %v", body.didPeek, tt.wantPeek)
+			}
+		})
+	}
+}
@@ -0,0 +1,482 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/without-php/BFF-proxy/internal/config"
+	"github.com/without-php/BFF-proxy/internal/logger"
+)
+
+// 代理返回的 gRPC 状态码
+const (
+	grpcStatusUnimplemented = 12
+	grpcStatusUnavailable   = 14
+)
+
+// maxGRPCFrameSize gRPC-Web 转换时单条消息的最大长度
+const maxGRPCFrameSize = 64 << 20
+
+// GRPCHandler 返回转发 gRPC 请求的 http.Handler，由支持 HTTP/2 的监听（HTTPS、h2c）调用
+func (p *ProxyMiddleware) GRPCHandler() http.Handler {
+	return http.HandlerFunc(p.serveGRPC)
+}
+
+// serveGRPC 转发 gRPC 请求
+// 按 /package.Service/Method 路径匹配规则，以 HTTP/2 转发到上游，流式透传请求体、响应体和 trailer
+// gRPC 调用可能是长时间的流，不受规则的 timeout 限制
+func (p *ProxyMiddleware) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	cfg := config.GetConfig()
+
+	// 构造 Hertz 请求上下文，复用规则匹配、负载均衡和路径重写；请求体是流式的 protobuf，不参与匹配
+	c := app.NewContext(0)
+	c.Request.Header.SetMethod(r.Method)
+	c.Request.SetRequestURI(r.URL.RequestURI())
+	for key, values := range r.Header {
+		for _, value := range values {
+			c.Request.Header.Add(key, value)
+		}
+	}
+	c.Request.SetHost(r.Host)
+	rule, pathParams := p.findMatchingRule(c, cfg, newRequestBody(c))
+
+	client := newClientConn(c, r.RemoteAddr, &cfg.Proxy.Forwarding)
+	reqLog := &logger.RequestLog{
+		RequestID:  newRequestID(),
+		StartTime:  startTime,
+		ClientIP:   client.ip,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Headers:    p.extractHeaders(c),
+		PathParams: pathParams,
+		StatusCode: http.StatusOK,
+	}
+	finish := func() {
+		reqLog.EndTime = time.Now()
+		reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+		logger.LogRequest(reqLog)
+	}
+
+	if rule == nil {
+		reqLog.Error = "没有找到匹配的代理规则"
+		reqLog.GRPCStatus = strconv.Itoa(grpcStatusUnimplemented)
+		writeGRPCError(w, grpcStatusUnimplemented, reqLog.Error)
+		finish()
+		return
+	}
+	reqLog.RuleName = rule.Name
+
+	target, done, probe, err := p.balancer.pick(c, rule)
+	if err != nil {
+		reqLog.Error = err.Error()
+		reqLog.GRPCStatus = strconv.Itoa(grpcStatusUnavailable)
+		writeGRPCError(w, grpcStatusUnavailable, err.Error())
+		finish()
+		return
+	}
+	reqLog.Target = target
+	defer done()
+
+	vars := &templateVars{c: c, pathParams: pathParams, client: client, requestID: reqLog.RequestID}
+	uri := rewriteRequestURI(rule, vars)
+	if uri != r.URL.RequestURI() {
+		reqLog.UpstreamURI = uri
+	}
+
+	requestCapture := newBodyCapture(cfg.Log.MaxBodySize)
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, buildTargetURL(target, uri), io.TeeReader(r.Body, requestCapture))
+	if err != nil {
+		reqLog.Error = fmt.Sprintf("创建请求失败: %v", err)
+		reqLog.GRPCStatus = strconv.Itoa(grpcStatusUnavailable)
+		writeGRPCError(w, grpcStatusUnavailable, reqLog.Error)
+		finish()
+		return
+	}
+	req.ContentLength = r.ContentLength
+	req.Header = r.Header.Clone()
+	applyRequestHeaders(req.Header, rule, vars)
+	// gRPC 上游要求 TE: trailers，逐跳头部处理时已经被删除
+	req.Header.Set("Te", "trailers")
+	if rule.PreserveHost {
+		req.Host = r.Host
+	}
+
+	resp, err := p.doGRPC(req, rule, target, probe)
+	reqLog.Body = requestCapture.Format(r.Header.Get("Content-Type"))
+	if err != nil {
+		reqLog.Error = err.Error()
+		reqLog.GRPCStatus = strconv.Itoa(grpcStatusUnavailable)
+		writeGRPCError(w, grpcStatusUnavailable, fmt.Sprintf("代理请求失败: %v", err))
+		finish()
+		return
+	}
+	defer resp.Body.Close()
+
+	// 复制响应头，逐条消息刷新给客户端，结束后补上 trailer
+	header := transformResponseHeader(resp.Header, rule, vars).Clone()
+	removeHopHeaders(header)
+	for key, values := range header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	responseCapture := newBodyCapture(cfg.Log.MaxBodySize)
+	copyErr := copyFlushing(w, io.TeeReader(resp.Body, responseCapture))
+	for key, values := range resp.Trailer {
+		for _, value := range values {
+			w.Header().Add(http.TrailerPrefix+key, value)
+		}
+	}
+
+	reqLog.Body = requestCapture.Format(r.Header.Get("Content-Type"))
+	reqLog.StatusCode = resp.StatusCode
+	reqLog.ResponseBody = responseCapture.Format(resp.Header.Get("Content-Type"))
+	status, message := grpcStatus(resp)
+	reqLog.GRPCStatus = status
+	switch {
+	case copyErr != nil:
+		reqLog.Error = fmt.Sprintf("读取响应失败: %v", copyErr)
+	case status != "" && status != "0":
+		reqLog.Error = message
+	}
+	finish()
+}
+
+// doGRPC 以 HTTP/2 把 gRPC 请求发到上游，按收到响应头的结果更新健康状态和熔断器
+func (p *ProxyMiddleware) doGRPC(req *http.Request, rule *config.ProxyRule, target string, probe int) (*http.Response, error) {
+	transport, err := p.transports.getGRPC(target, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := transport.do(req)
+	latency := time.Since(start)
+	if err != nil {
+		p.health.report(target, rule.HealthCheck, false, err.Error())
+		p.breakers.record(target, rule.Breaker, probe, false, latency)
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+
+	// UNAVAILABLE 表示上游不可用，其他 gRPC 状态属于业务结果
+	status, _ := grpcStatus(resp)
+	success := !isFailureStatus(resp.StatusCode) && status != strconv.Itoa(grpcStatusUnavailable)
+	p.health.report(target, rule.HealthCheck, success, fmt.Sprintf("上游返回状态码 %d，grpc-status %s", resp.StatusCode, status))
+	p.breakers.record(target, rule.Breaker, probe, success, latency)
+	return resp, nil
+}
+
+// grpcStatus 返回 grpc-status 和 grpc-message，先查 trailer，只有响应头时（trailers-only）查响应头
+// 需要在响应体读取结束后调用才能取到 trailer
+func grpcStatus(resp *http.Response) (string, string) {
+	if status := resp.Trailer.Get("Grpc-Status"); status != "" {
+		return status, decodeGRPCMessage(resp.Trailer.Get("Grpc-Message"))
+	}
+	return resp.Header.Get("Grpc-Status"), decodeGRPCMessage(resp.Header.Get("Grpc-Message"))
+}
+
+// writeGRPCError 返回只有响应头的 gRPC 错误响应
+func writeGRPCError(w http.ResponseWriter, code int, message string) {
+	header := w.Header()
+	header.Set("Content-Type", "application/grpc")
+	header.Set("Grpc-Status", strconv.Itoa(code))
+	header.Set("Grpc-Message", encodeGRPCMessage(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage 按 gRPC 协议对 grpc-message 做百分号编码（可打印 ASCII 以外的字节和 %）
+func encodeGRPCMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= 0x20 && c <= 0x7e && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// decodeGRPCMessage 解码百分号编码的 grpc-message，格式不正确的部分保持原样
+func decodeGRPCMessage(message string) string {
+	if !strings.Contains(message, "%") {
+		return message
+	}
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		if message[i] == '%' && i+2 < len(message) {
+			if value, err := strconv.ParseUint(message[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(value))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(message[i])
+	}
+	return b.String()
+}
+
+// copyFlushing 复制响应体，每次读到数据后立即刷新给客户端
+func copyFlushing(w http.ResponseWriter, body io.Reader) error {
+	controller := http.NewResponseController(w)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return writeErr
+			}
+			controller.Flush()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// isGRPCWebRequest 判断是否是 gRPC-Web 请求
+func isGRPCWebRequest(c *app.RequestContext) bool {
+	return strings.HasPrefix(string(c.Request.Header.ContentType()), "application/grpc-web")
+}
+
+// isPreflightRequest 判断是否是浏览器的 CORS 预检请求
+func isPreflightRequest(c *app.RequestContext) bool {
+	return string(c.Method()) == http.MethodOptions && len(c.Request.Header.Peek("Access-Control-Request-Method")) > 0
+}
+
+// writeGRPCWebPreflight 响应 gRPC-Web 的 CORS 预检请求
+func writeGRPCWebPreflight(c *app.RequestContext) {
+	origin := string(c.Request.Header.Peek("Origin"))
+	if origin == "" {
+		origin = "*"
+	}
+	c.Response.Header.Set("Access-Control-Allow-Origin", origin)
+	c.Response.Header.Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	c.Response.Header.Set("Access-Control-Allow-Headers", string(c.Request.Header.Peek("Access-Control-Request-Headers")))
+	c.Response.Header.Set("Access-Control-Max-Age", "86400")
+	c.Response.Header.Set("Vary", "Origin")
+	c.Response.Header.SetNoDefaultContentType(true)
+	c.Status(http.StatusNoContent)
+}
+
+// setGRPCWebCORSHeaders 设置 gRPC-Web 响应的 CORS 头，浏览器需要读取 grpc-status 等响应头
+func setGRPCWebCORSHeaders(c *app.RequestContext) {
+	if origin := string(c.Request.Header.Peek("Origin")); origin != "" {
+		c.Response.Header.Set("Access-Control-Allow-Origin", origin)
+		c.Response.Header.Set("Vary", "Origin")
+	}
+	c.Response.Header.Set("Access-Control-Expose-Headers", "grpc-status, grpc-message, grpc-status-details-bin")
+}
+
+// proxyGRPCWeb 把 gRPC-Web 请求转换为 gRPC 转发到上游，响应转换回 gRPC-Web
+// 请求体和响应体的消息帧格式相同；trailer 编码为响应体末尾标志位 0x80 的帧；
+// application/grpc-web-text 的请求体和响应体使用 base64 编码
+func (p *ProxyMiddleware) proxyGRPCWeb(ctx context.Context, c *app.RequestContext, rule *config.ProxyRule, target string, probe int, uri string, vars *templateVars, body *requestBody, reqLog *logger.RequestLog, done func()) {
+	cfg := config.GetConfig()
+	contentType := string(c.Request.Header.ContentType())
+	text := strings.HasPrefix(contentType, "application/grpc-web-text")
+
+	fail := func(err error) {
+		done()
+		reqLog.EndTime = time.Now()
+		reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+		reqLog.StatusCode = http.StatusOK
+		reqLog.GRPCStatus = strconv.Itoa(grpcStatusUnavailable)
+		reqLog.Error = err.Error()
+		logger.LogRequest(reqLog)
+
+		c.Response.Header.Set("Content-Type", contentType)
+		c.Response.Header.Set("Grpc-Status", reqLog.GRPCStatus)
+		c.Response.Header.Set("Grpc-Message", encodeGRPCMessage(fmt.Sprintf("代理请求失败: %v", err)))
+		setGRPCWebCORSHeaders(c)
+		c.Status(http.StatusOK)
+	}
+
+	requestCapture := newBodyCapture(cfg.Log.MaxBodySize)
+	reader := io.TeeReader(body.Reader(), requestCapture)
+	contentLength := body.ContentLength()
+	if text {
+		reader = base64.NewDecoder(base64.StdEncoding, reader)
+		contentLength = -1
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, buildTargetURL(target, uri), reader)
+	if err != nil {
+		fail(fmt.Errorf("创建请求失败: %w", err))
+		return
+	}
+	req.ContentLength = contentLength
+
+	req.Header = requestHeader(c, rule, vars)
+	if rule.PreserveHost {
+		req.Host = string(c.Host())
+	}
+	for _, key := range []string{"Content-Length", "X-Grpc-Web", "Origin", "Referer"} {
+		req.Header.Del(key)
+	}
+	req.Header.Set("Content-Type", "application/grpc"+grpcWebSubtype(contentType))
+	// gRPC 上游要求 TE: trailers，逐跳头部处理时已经被删除
+	req.Header.Set("Te", "trailers")
+
+	resp, err := p.doGRPC(req, rule, target, probe)
+	reqLog.Body = requestCapture.Format(contentType)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	header := transformResponseHeader(resp.Header, rule, vars).Clone()
+	removeHopHeaders(header)
+	header.Del("Content-Length")
+	header.Del("Content-Type")
+	for key, values := range header {
+		for _, value := range values {
+			c.Response.Header.Add(key, value)
+		}
+	}
+	c.Response.Header.Set("Content-Type", contentType)
+	setGRPCWebCORSHeaders(c)
+	c.Status(resp.StatusCode)
+	// 服务端流式响应需要尽快把响应头发给客户端
+	c.Response.ImmediateHeaderFlush = true
+
+	c.Response.SetBodyStream(&loggingBody{
+		body:    newGRPCWebBody(resp, text),
+		capture: newBodyCapture(cfg.Log.MaxBodySize),
+		onClose: func(capture *bodyCapture, err error) {
+			done()
+
+			reqLog.EndTime = time.Now()
+			reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+			reqLog.StatusCode = resp.StatusCode
+			reqLog.ResponseBody = capture.Format(contentType)
+			status, message := grpcStatus(resp)
+			reqLog.GRPCStatus = status
+			switch {
+			case err != nil:
+				reqLog.Error = fmt.Sprintf("读取响应失败: %v", err)
+			case status != "" && status != "0":
+				reqLog.Error = message
+			}
+			logger.LogRequest(reqLog)
+		},
+	}, -1)
+}
+
+// grpcWebSubtype 返回 gRPC-Web Content-Type 中的编码后缀，如 +proto
+func grpcWebSubtype(contentType string) string {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	for _, prefix := range []string{"application/grpc-web-text", "application/grpc-web"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(contentType, prefix))
+		}
+	}
+	return ""
+}
+
+// grpcWebBody 把上游的 gRPC 响应体转换为 gRPC-Web 响应体
+// 按消息帧读取，读完后追加 trailer 帧；text 模式下每一帧单独 base64 编码，保证流式响应能及时发出
+type grpcWebBody struct {
+	resp    *http.Response
+	reader  *bufio.Reader
+	text    bool
+	pending []byte
+	done    bool
+}
+
+// newGRPCWebBody 创建 gRPC-Web 响应体
+func newGRPCWebBody(resp *http.Response, text bool) *grpcWebBody {
+	return &grpcWebBody{resp: resp, reader: bufio.NewReader(resp.Body), text: text}
+}
+
+// Read 实现 io.Reader
+func (b *grpcWebBody) Read(p []byte) (int, error) {
+	for len(b.pending) == 0 {
+		if b.done {
+			return 0, io.EOF
+		}
+		frame, err := readGRPCFrame(b.reader)
+		if err == io.EOF {
+			frame = grpcWebTrailerFrame(b.resp)
+			b.done = true
+		} else if err != nil {
+			return 0, err
+		}
+		if b.text {
+			frame = []byte(base64.StdEncoding.EncodeToString(frame))
+		}
+		b.pending = frame
+	}
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+// Close 实现 io.Closer
+func (b *grpcWebBody) Close() error {
+	return b.resp.Body.Close()
+}
+
+// readGRPCFrame 读取一条完整的 gRPC 消息帧（1 字节标志位 + 4 字节长度 + 消息），响应体结束时返回 io.EOF
+func readGRPCFrame(r *bufio.Reader) ([]byte, error) {
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(r, head); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("gRPC 消息帧不完整: %w", err)
+		}
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(head[1:])
+	if length > maxGRPCFrameSize {
+		return nil, fmt.Errorf("gRPC 消息长度 %d 超过限制", length)
+	}
+	frame := make([]byte, 5+int(length))
+	copy(frame, head)
+	if _, err := io.ReadFull(r, frame[5:]); err != nil {
+		return nil, fmt.Errorf("gRPC 消息帧不完整: %w", err)
+	}
+	return frame, nil
+}
+
+// grpcWebTrailerFrame 把上游的 trailer 编码为 gRPC-Web 的 trailer 帧
+func grpcWebTrailerFrame(resp *http.Response) []byte {
+	trailer := resp.Trailer
+	if trailer.Get("Grpc-Status") == "" {
+		// trailers-only 响应的状态在响应头中
+		trailer = http.Header{}
+		for _, key := range []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"} {
+			if value := resp.Header.Get(key); value != "" {
+				trailer.Set(key, value)
+			}
+		}
+	}
+
+	var b strings.Builder
+	for key, values := range trailer {
+		for _, value := range values {
+			b.WriteString(strings.ToLower(key))
+			b.WriteString(": ")
+			b.WriteString(value)
+			b.WriteString("\r\n")
+		}
+	}
+	frame := make([]byte, 5+b.Len())
+	frame[0] = 0x80
+	binary.BigEndian.PutUint32(frame[1:5], uint32(b.Len()))
+	copy(frame[5:], b.String())
+	return frame
+}
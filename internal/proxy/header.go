@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// hopHeaders 逐跳头部，只对单个连接有效，不应被代理转发
+// 参考 RFC 7230 第 6.1 节
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders 删除逐跳头部（包括 Connection 头中声明的头部）
+func removeHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				header.Del(field)
+			}
+		}
+	}
+	for _, key := range hopHeaders {
+		header.Del(key)
+	}
+}
+
+// copyResponseHeaders 将上游响应头复制到客户端响应（不含逐跳头部）
+func copyResponseHeaders(c *app.RequestContext, header http.Header) {
+	header = header.Clone()
+	removeHopHeaders(header)
+
+	for key, values := range header {
+		for _, value := range values {
+			c.Response.Header.Add(key, value)
+		}
+	}
+
+	// 上游没有返回 Content-Type 时，不使用 Hertz 的默认值
+	if header.Get("Content-Type") == "" {
+		c.Response.Header.SetNoDefaultContentType(true)
+	}
+}
+
+// isTextContentType 判断 Content-Type 是否为文本类型（用于日志记录）
+func isTextContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	if contentType == "" || strings.HasPrefix(contentType, "text/") {
+		return true
+	}
+	for _, keyword := range []string{"json", "xml", "javascript", "x-www-form-urlencoded", "graphql"} {
+		if strings.Contains(contentType, keyword) {
+			return true
+		}
+	}
+	return false
+}
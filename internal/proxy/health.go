@@ -0,0 +1,269 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// errNoHealthyTarget 所有上游目标都不健康或已熔断
+var errNoHealthyTarget = errors.New("没有健康的上游目标（健康检查未通过或已熔断）")
+
+// healthChecker 上游健康检查
+// 主动探测按（目标地址, 探测配置）启动后台协程；被动检查根据转发结果统计连续失败次数
+// 健康状态按目标地址保存，多个规则共享
+type healthChecker struct {
+	mu         sync.Mutex
+	targets    map[string]*targetHealth      // 目标地址 -> 健康状态
+	probes     map[string]context.CancelFunc // 探测任务 -> 停止函数
+	transports *transportRegistry            // 探测请求使用规则的连接池和 TLS 配置
+}
+
+// targetHealth 单个目标的健康状态
+type targetHealth struct {
+	probeHealthy bool      // 主动探测结果
+	probeEnabled bool      // 是否启用了主动探测
+	lastProbe    time.Time // 最近一次探测时间
+	lastError    string    // 最近一次失败原因
+	failures     int       // 被动检查：连续失败次数
+	ejectedUntil time.Time // 被动检查：摘除截止时间
+}
+
+// HealthStatus 上游目标健康状态（用于管理接口）
+type HealthStatus struct {
+	URL          string    `json:"url"`
+	Rules        []string  `json:"rules"`                // 使用该目标的规则
+	Healthy      bool      `json:"healthy"`              // 综合健康状态
+	ProbeEnabled bool      `json:"probe_enabled"`        // 是否启用主动探测
+	ProbeHealthy bool      `json:"probe_healthy"`        // 主动探测结果
+	LastProbe    time.Time `json:"last_probe"`           // 最近一次探测时间
+	Failures     int       `json:"failures"`             // 连续失败次数
+	EjectedUntil time.Time `json:"ejected_until"`        // 被动摘除截止时间
+	LastError    string    `json:"last_error,omitempty"` // 最近一次失败原因
+}
+
+// newHealthChecker 创建健康检查器
+func newHealthChecker(transports *transportRegistry) *healthChecker {
+	return &healthChecker{
+		targets:    make(map[string]*targetHealth),
+		probes:     make(map[string]context.CancelFunc),
+		transports: transports,
+	}
+}
+
+// state 返回目标的健康状态（需要先获取锁）
+func (h *healthChecker) state(target string) *targetHealth {
+	st, ok := h.targets[target]
+	if !ok {
+		st = &targetHealth{probeHealthy: true}
+		h.targets[target] = st
+	}
+	return st
+}
+
+// isHealthy 判断目标是否健康：主动探测通过且没有被被动摘除
+func (h *healthChecker) isHealthy(target string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st := h.state(target)
+	return st.probeHealthy && !time.Now().Before(st.ejectedUntil)
+}
+
+// report 被动检查：记录一次转发结果，连续失败达到 max_fails 后摘除目标
+func (h *healthChecker) report(target string, hc config.HealthCheckConfig, success bool, reason string) {
+	if hc.MaxFails <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st := h.state(target)
+	if success {
+		st.failures = 0
+		return
+	}
+
+	st.failures++
+	st.lastError = reason
+	if st.failures >= hc.MaxFails {
+		failTimeout := time.Duration(hc.FailTimeout) * time.Second
+		if failTimeout <= 0 {
+			failTimeout = 30 * time.Second
+		}
+		st.ejectedUntil = time.Now().Add(failTimeout)
+	}
+}
+
+// reconcile 根据配置启动新的主动探测任务，停止不再需要的任务
+func (h *healthChecker) reconcile(cfg *config.Config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, rule := range cfg.Proxy.Rules {
+		hc := rule.HealthCheck
+		if hc.Path == "" {
+			continue
+		}
+		for _, target := range rule.UpstreamTargets() {
+			key := fmt.Sprintf("%s|%s|%d|%d|%d", transportKey(target.URL, &rule), hc.Path, hc.Interval, hc.Timeout, hc.ExpectedStatus)
+			wanted[key] = true
+			if _, running := h.probes[key]; running {
+				continue
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			h.probes[key] = cancel
+			h.state(target.URL).probeEnabled = true
+			go h.probeLoop(ctx, target.URL, rule)
+		}
+	}
+
+	for key, cancel := range h.probes {
+		if wanted[key] {
+			continue
+		}
+		cancel()
+		delete(h.probes, key)
+
+		// 目标不再主动探测时恢复为健康
+		target, _, _ := strings.Cut(key, "|")
+		if !h.hasProbe(target) {
+			st := h.state(target)
+			st.probeEnabled = false
+			st.probeHealthy = true
+		}
+	}
+}
+
+// hasProbe 判断目标是否还有探测任务（需要先获取锁）
+func (h *healthChecker) hasProbe(target string) bool {
+	for key := range h.probes {
+		if strings.HasPrefix(key, target+"|") {
+			return true
+		}
+	}
+	return false
+}
+
+// probeLoop 定期主动探测目标
+func (h *healthChecker) probeLoop(ctx context.Context, target string, rule config.ProxyRule) {
+	hc := rule.HealthCheck
+	interval := time.Duration(hc.Interval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := h.probe(ctx, target, &rule)
+		if ctx.Err() != nil {
+			return
+		}
+
+		h.mu.Lock()
+		st := h.state(target)
+		st.lastProbe = time.Now()
+		st.probeHealthy = err == nil
+		if err != nil {
+			st.lastError = err.Error()
+		}
+		h.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe 发送一次探测请求
+func (h *healthChecker) probe(ctx context.Context, target string, rule *config.ProxyRule) error {
+	hc := rule.HealthCheck
+	transport, err := h.transports.get(target, rule)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(hc.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	probeURL := strings.TrimSuffix(target, "/") + "/" + strings.TrimPrefix(hc.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL, nil)
+	if err != nil {
+		return fmt.Errorf("创建探测请求失败: %w", err)
+	}
+
+	resp, err := transport.do(req)
+	if err != nil {
+		return fmt.Errorf("探测请求失败: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if hc.ExpectedStatus != 0 {
+		if resp.StatusCode != hc.ExpectedStatus {
+			return fmt.Errorf("探测状态码 %d，期望 %d", resp.StatusCode, hc.ExpectedStatus)
+		}
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("探测状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// status 返回当前配置中所有上游目标的健康状态
+func (h *healthChecker) status(cfg *config.Config) []HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	statuses := make([]HealthStatus, 0)
+	index := make(map[string]int)
+	for _, rule := range cfg.Proxy.Rules {
+		for _, target := range rule.UpstreamTargets() {
+			if i, ok := index[target.URL]; ok {
+				statuses[i].Rules = append(statuses[i].Rules, rule.Name)
+				continue
+			}
+
+			st := h.state(target.URL)
+			index[target.URL] = len(statuses)
+			statuses = append(statuses, HealthStatus{
+				URL:          target.URL,
+				Rules:        []string{rule.Name},
+				Healthy:      st.probeHealthy && !time.Now().Before(st.ejectedUntil),
+				ProbeEnabled: st.probeEnabled,
+				ProbeHealthy: st.probeHealthy,
+				LastProbe:    st.lastProbe,
+				Failures:     st.failures,
+				EjectedUntil: st.ejectedUntil,
+				LastError:    st.lastError,
+			})
+		}
+	}
+	return statuses
+}
+
+// isFailureStatus 被动检查中视为失败的状态码（网关类错误）
+func isFailureStatus(statusCode int) bool {
+	return statusCode == http.StatusBadGateway ||
+		statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+}
@@ -1,31 +1,81 @@
 package proxy
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
-	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/tidwall/gjson"
 	"github.com/without-php/BFF-proxy/internal/config"
 	"github.com/without-php/BFF-proxy/internal/logger"
 )
 
 // ProxyMiddleware 代理中间件
 type ProxyMiddleware struct {
-	config *config.Config
+	config     *config.Config
+	balancer   *balancer
+	health     *healthChecker
+	retries    *retryBudget
+	breakers   *breakerSet
+	transports *transportRegistry
 }
 
 // NewProxyMiddleware 创建代理中间件
 func NewProxyMiddleware(cfg *config.Config) *ProxyMiddleware {
-	return &ProxyMiddleware{
+	transports := newTransportRegistry()
+	health := newHealthChecker(transports)
+	breakers := newBreakerSet()
+	p := &ProxyMiddleware{
 		config: cfg,
+		// 健康检查未通过的目标不参与分配；配置了熔断器的规则跳过已熔断的目标，选中时占用半开状态的探测名额
+		balancer: newBalancer(func(rule *config.ProxyRule, target string) bool {
+			return health.isHealthy(target) && (rule.Breaker == nil || breakers.available(target))
+		}, func(rule *config.ProxyRule, target string) (func(), int, bool) {
+			return breakers.reserve(target, rule.Breaker)
+		}),
+		health:     health,
+		retries:    newRetryBudget(),
+		breakers:   breakers,
+		transports: transports,
 	}
+
+	// 配置变更时同步主动健康检查任务，关闭不再使用的连接池
+	health.reconcile(cfg)
+	config.OnChange(health.reconcile)
+	config.OnChange(transports.reconcile)
+
+	return p
+}
+
+// HealthStatus 返回当前配置中所有上游目标的健康状态
+func (p *ProxyMiddleware) HealthStatus() []HealthStatus {
+	return p.health.status(config.GetConfig())
+}
+
+// BreakerStatus 返回当前配置中所有配置了熔断器的上游目标的熔断状态
+func (p *ProxyMiddleware) BreakerStatus() []BreakerStatus {
+	return p.breakers.status(config.GetConfig())
+}
+
+// TransportStatus 返回所有上游连接池的状态
+func (p *ProxyMiddleware) TransportStatus() []TransportStatus {
+	return p.transports.status()
+}
+
+// UpstreamStatus 返回当前配置中所有上游目标的状态
+func (p *ProxyMiddleware) UpstreamStatus() []UpstreamStatus {
+	return p.balancer.status(config.GetConfig())
+}
+
+// SetUpstreamDrained 运行时摘除（或恢复）上游目标，不修改配置文件
+func (p *ProxyMiddleware) SetUpstreamDrained(target string, drained bool) {
+	p.balancer.setDrained(target, drained)
 }
 
 // Handle 处理请求
@@ -40,22 +90,41 @@ func (p *ProxyMiddleware) Handle(ctx context.Context, c *app.RequestContext) {
 	startTime := time.Now()
 	cfg := config.GetConfig()
 
-	// 读取请求体
-	bodyBytes := c.Request.BodyBytes()
-	c.Request.SetBody(bodyBytes)
+	// 请求体以流的形式读取，只有 Body 匹配需要时才预读
+	body := newRequestBody(c)
 
 	// 查找匹配的规则
-	rule := p.findMatchingRule(c, cfg)
+	rule, pathParams := p.findMatchingRule(c, cfg, body)
 
 	// 准备请求日志（无论是否找到规则都要记录）
+	requestContentType := string(c.Request.Header.ContentType())
 	queryString := string(c.QueryArgs().QueryString())
+	client := newClientConn(c, c.RemoteAddr().String(), &cfg.Proxy.Forwarding)
 	reqLog := &logger.RequestLog{
+		RequestID: newRequestID(),
 		StartTime: startTime,
+		ClientIP:  client.ip,
 		Method:    string(c.Method()),
 		Path:      path,
 		Query:     queryString,
 		Headers:   p.extractHeaders(c),
-		Body:      string(bodyBytes),
+	}
+	reqLog.PathParams = pathParams
+
+	// GraphQL 请求记录操作名，匹配时没有解析过的请求在这里解析
+	reqLog.GraphQLOperation = graphqlLogOperation(c, body)
+
+	// 调试模式：在响应头中返回匹配结果和每个没有生效的规则的原因，调试请求头不转发给上游
+	debug := isDebugRequest(c, cfg)
+	if debug {
+		c.Request.Header.Del(debugRequestHeader)
+		setDebugHeader(c, debugRequestIDHeader, reqLog.RequestID)
+		if rule != nil {
+			setDebugHeader(c, debugRuleHeader, rule.Name)
+		}
+		for _, reason := range p.explainRules(c, cfg, body, rule) {
+			addDebugHeader(c, debugExplainHeader, reason)
+		}
 	}
 
 	if rule == nil {
@@ -68,6 +137,11 @@ func (p *ProxyMiddleware) Handle(ctx context.Context, c *app.RequestContext) {
 		reqLog.RuleName = ""
 		reqLog.Error = "没有找到匹配的代理规则"
 
+		// 请求没有转发，只记录预读的请求体前缀
+		capture := newBodyCapture(cfg.Log.MaxBodySize)
+		capture.Write(body.Peek())
+		reqLog.Body = capture.Format(requestContentType)
+
 		// 记录日志
 		logger.LogRequest(reqLog)
 
@@ -77,227 +151,516 @@ func (p *ProxyMiddleware) Handle(ctx context.Context, c *app.RequestContext) {
 	}
 
 	// 设置规则信息
-	reqLog.Target = rule.Target
 	reqLog.RuleName = rule.Name
 
-	// 执行代理转发
-	statusCode, responseBody, err := p.proxyRequest(ctx, c, rule)
+	// 浏览器发起 gRPC-Web 请求前的 CORS 预检由代理直接响应
+	grpcWeb := rule.GRPC != nil && rule.GRPC.Web
+	if grpcWeb && isPreflightRequest(c) {
+		writeGRPCWebPreflight(c)
+		reqLog.EndTime = time.Now()
+		reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+		reqLog.StatusCode = http.StatusNoContent
+		logger.LogRequest(reqLog)
+		return
+	}
+
+	// 聚合规则向多个上游发起子请求，合并结果后返回，客户端的请求体不转发
+	if rule.Composite != nil {
+		capture := newBodyCapture(cfg.Log.MaxBodySize)
+		capture.Write(body.Peek())
+		reqLog.Body = capture.Format(requestContentType)
+
+		vars := &templateVars{c: c, pathParams: pathParams, client: client, requestID: reqLog.RequestID}
+		p.handleComposite(ctx, c, rule, vars, reqLog, cfg.Log.MaxBodySize)
+		return
+	}
 
-	reqLog.EndTime = time.Now()
-	reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
-	reqLog.StatusCode = statusCode
-	reqLog.ResponseBody = responseBody
+	// 选择上游目标
+	target, done, probe, err := p.balancer.pick(c, rule)
 	if err != nil {
+		reqLog.EndTime = time.Now()
+		reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
 		reqLog.Error = err.Error()
+
+		if rule.Fallback != nil {
+			// 没有可用的上游目标时返回兜底响应
+			reqLog.StatusCode, reqLog.ResponseBody = writeFallback(c, rule.Fallback)
+		} else {
+			reqLog.StatusCode = http.StatusServiceUnavailable
+			c.JSON(http.StatusServiceUnavailable, map[string]string{
+				"error": fmt.Sprintf("代理请求失败: %v", err),
+			})
+		}
+
+		// 记录日志
+		logger.LogRequest(reqLog)
+		return
 	}
+	reqLog.Target = target
 
-	// 记录日志
-	logger.LogRequest(reqLog)
+	// 重写路径和查询参数，重试时复用
+	vars := &templateVars{c: c, pathParams: pathParams, client: client, requestID: reqLog.RequestID}
+	uri := rewriteRequestURI(rule, vars)
+	if original := string(c.Request.URI().RequestURI()); uri != original {
+		reqLog.UpstreamURI = uri
+	}
+	if debug {
+		setDebugHeader(c, debugTargetHeader, target)
+		setDebugHeader(c, debugUpstreamURIHeader, uri)
+	}
+
+	// WebSocket 握手请求走隧道转发
+	if isWebSocketRequest(c) {
+		p.proxyWebSocket(c, rule, target, probe, uri, vars, reqLog, done)
+		return
+	}
 
-	// 返回响应
+	// gRPC-Web 请求转换为 gRPC 转发
+	if grpcWeb && isGRPCWebRequest(c) {
+		p.proxyGRPCWeb(ctx, c, rule, target, probe, uri, vars, body, reqLog, done)
+		return
+	}
+
+	// 请求体转换在转发之前执行，转换后的请求体完整保存在内存中，重试时复用
+	// 转换失败时拒绝请求，避免把没有去掉敏感字段的请求体转发给上游
+	if transform := requestBodyTransform(rule, c); transform != nil {
+		if err := transformRequestBody(c, body, transform, vars); err != nil {
+			done()
+			reqLog.EndTime = time.Now()
+			reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+			reqLog.StatusCode = http.StatusBadRequest
+			if errors.Is(err, errBodyTooLarge) {
+				reqLog.StatusCode = http.StatusRequestEntityTooLarge
+			}
+			reqLog.Error = fmt.Sprintf("请求体转换失败: %v", err)
+			logger.LogRequest(reqLog)
+
+			c.JSON(reqLog.StatusCode, map[string]string{
+				"error": reqLog.Error,
+			})
+			return
+		}
+		requestContentType = string(c.Request.Header.ContentType())
+	}
+
+	// 转发时只记录请求体前缀
+	requestCapture := newBodyCapture(cfg.Log.MaxBodySize)
+
+	// 执行代理转发（按重试策略重试）
+	upstream, err := p.forward(ctx, c, rule, target, probe, uri, vars, done, body, requestCapture, reqLog)
 	if err != nil {
+		reqLog.EndTime = time.Now()
+		reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+		reqLog.Body = requestCapture.Format(requestContentType)
+		reqLog.Error = err.Error()
+
+		// 记录日志
+		logger.LogRequest(reqLog)
+
 		c.JSON(http.StatusBadGateway, map[string]string{
 			"error": fmt.Sprintf("代理请求失败: %v", err),
 		})
 		return
 	}
+	resp := upstream.Response
+
+	// 复制响应头和状态码，保留上游的 Content-Type
+	copyResponseHeaders(c, transformResponseHeader(resp.Header, rule, vars))
+	c.Status(resp.StatusCode)
+
+	// SSE 需要立即把响应头发给客户端
+	if isSSEResponse(resp) {
+		c.Response.ImmediateHeaderFlush = true
+	}
 
-	c.Data(statusCode, consts.MIMEApplicationJSON, []byte(responseBody))
+	// 响应体转换需要读取完整的响应体，转换失败时原样返回
+	if transform := responseBodyTransform(rule, resp); transform != nil {
+		if err := transformResponseBody(c, resp, transform, vars); err != nil {
+			reqLog.Error = fmt.Sprintf("响应体转换失败: %v", err)
+		}
+	}
+
+	// 响应体以流的形式返回给客户端，传输结束后再记录日志
+	responseContentType := resp.Header.Get("Content-Type")
+	c.Response.SetBodyStream(&loggingBody{
+		body:    resp.Body,
+		capture: newBodyCapture(cfg.Log.MaxBodySize),
+		onClose: func(capture *bodyCapture, err error) {
+			upstream.release()
+			upstream.done()
+
+			reqLog.EndTime = time.Now()
+			reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+			reqLog.StatusCode = resp.StatusCode
+			reqLog.Body = requestCapture.Format(requestContentType)
+			if isSSEResponse(resp) {
+				reqLog.ResponseBody = "[SSE Stream]"
+			} else {
+				reqLog.ResponseBody = capture.Format(responseContentType)
+			}
+			if err != nil {
+				reqLog.Error = fmt.Sprintf("读取响应失败: %v", err)
+			}
+
+			// 记录日志
+			logger.LogRequest(reqLog)
+		},
+	}, int(resp.ContentLength))
 }
 
-// findMatchingRule 查找匹配的规则
-func (p *ProxyMiddleware) findMatchingRule(c *app.RequestContext, cfg *config.Config) *config.ProxyRule {
-	path := string(c.Path())
-	method := string(c.Method())
+// findMatchingRule 查找匹配的规则，同时返回路径匹配的命名捕获
+// 规则按优先级从高到低匹配，同一优先级按配置顺序；best 模式下同一优先级中最具体的规则生效
+func (p *ProxyMiddleware) findMatchingRule(c *app.RequestContext, cfg *config.Config, body *requestBody) (*config.ProxyRule, map[string]string) {
+	var best *config.ProxyRule
+	var bestParams map[string]string
+	// 路由表按路径前缀筛选出可能匹配的规则，顺序与逐个匹配时相同
+	var buf [16]int
+	for _, i := range cfg.Proxy.Routes().Candidates(string(c.Path()), buf[:]) {
+		rule := &cfg.Proxy.Rules[i]
+		if best != nil && rule.Priority < best.Priority {
+			// 后面的规则优先级更低，不会再胜出
+			break
+		}
+		pathParams, ok := p.matchCondition(c, &rule.Match, body, nil)
+		if !ok {
+			continue
+		}
+		if cfg.Proxy.MatchMode != config.MatchModeBest {
+			return rule, pathParams
+		}
+		if best == nil || rule.Specificity().MoreSpecific(best.Specificity()) {
+			best, bestParams = rule, pathParams
+		}
+	}
+
+	return best, bestParams
+}
+
+// matchCondition 判断请求是否满足匹配条件，同一条件中的各项需要同时满足
+// 返回路径匹配的命名捕获（包括 all、any 子条件中的捕获）；why 不为 nil 时记录不满足的条件，用于调试模式
+func (p *ProxyMiddleware) matchCondition(c *app.RequestContext, match *config.MatchCondition, body *requestBody, why *string) (map[string]string, bool) {
+	// 路径匹配（匹配器在配置加载时编译）
+	pathParams, ok := match.MatchPath(string(c.Path()))
+	if !ok {
+		if why != nil {
+			*why = "路径不匹配 " + match.Path
+		}
+		return nil, false
+	}
+
+	// 方法匹配
+	if match.Method != "" {
+		if !strings.EqualFold(match.Method, string(c.Method())) {
+			if why != nil {
+				*why = "方法不是 " + match.Method
+			}
+			return nil, false
+		}
+	}
 
-	for _, rule := range cfg.Proxy.Rules {
-		match := rule.Match
+	// Header 匹配
+	if len(match.Headers) > 0 {
+		if key, ok := p.matchHeaders(c, match.Headers); !ok {
+			if why != nil {
+				*why = "Header " + key + " 不满足条件"
+			}
+			return nil, false
+		}
+	}
 
-		// 路径匹配
-		if match.Path != "" {
-			if !strings.HasPrefix(path, match.Path) {
-				continue
+	// Query 匹配
+	if len(match.Query) > 0 {
+		if key, ok := p.matchQuery(c, match.Query); !ok {
+			if why != nil {
+				*why = "Query 参数 " + key + " 不满足条件"
 			}
+			return nil, false
 		}
+	}
 
-		// 方法匹配
-		if match.Method != "" {
-			if strings.ToUpper(match.Method) != strings.ToUpper(method) {
-				continue
+	// Body 匹配
+	if len(match.Body) > 0 {
+		if key, ok := p.matchBody(body, match.Body); !ok {
+			if why != nil {
+				*why = "Body 参数 " + key + " 不满足条件"
 			}
+			return nil, false
 		}
+	}
 
-		// Header 匹配
-		if len(match.Headers) > 0 {
-			if !p.matchHeaders(c, match.Headers) {
-				continue
+	// GraphQL 操作匹配
+	if match.GraphQL != nil {
+		if reason, ok := p.matchGraphQL(body, match.GraphQL); !ok {
+			if why != nil {
+				*why = reason
 			}
+			return nil, false
 		}
+	}
 
-		// Query 匹配
-		if len(match.Query) > 0 {
-			if !p.matchQuery(c, match.Query) {
-				continue
+	// 子条件全部满足
+	for i := range match.All {
+		params, ok := p.matchCondition(c, &match.All[i], body, why)
+		if !ok {
+			if why != nil {
+				*why = fmt.Sprintf("all 第 %d 个子条件: %s", i+1, *why)
 			}
+			return nil, false
 		}
+		pathParams = mergeParams(pathParams, params)
+	}
 
-		// Body 匹配
-		if len(match.Body) > 0 {
-			if !p.matchBody(c, match.Body) {
-				continue
+	// 子条件任意一个满足
+	if len(match.Any) > 0 {
+		matched := false
+		for i := range match.Any {
+			if params, ok := p.matchCondition(c, &match.Any[i], body, nil); ok {
+				pathParams = mergeParams(pathParams, params)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			if why != nil {
+				*why = "any 子条件都不满足"
 			}
+			return nil, false
 		}
+	}
 
-		return &rule
+	// 子条件不满足
+	if match.Not != nil {
+		if _, ok := p.matchCondition(c, match.Not, body, nil); ok {
+			if why != nil {
+				*why = "满足 not 子条件"
+			}
+			return nil, false
+		}
 	}
 
-	return nil
+	return pathParams, true
 }
 
-// matchHeaders 匹配请求头
-func (p *ProxyMiddleware) matchHeaders(c *app.RequestContext, conditions map[string]string) bool {
-	for key, value := range conditions {
-		headerValue := string(c.GetHeader(key))
-		if headerValue != value {
-			return false
+// mergeParams 合并路径参数，已有的参数不会被覆盖
+func mergeParams(dst, src map[string]string) map[string]string {
+	for key, value := range src {
+		if dst == nil {
+			dst = make(map[string]string, len(src))
+		}
+		if _, ok := dst[key]; !ok {
+			dst[key] = value
 		}
 	}
-	return true
+	return dst
 }
 
-// matchQuery 匹配查询参数
-func (p *ProxyMiddleware) matchQuery(c *app.RequestContext, conditions map[string]string) bool {
-	for key, value := range conditions {
-		queryValue := string(c.Query(key))
-		if queryValue != value {
-			return false
+// matchHeaders 匹配请求头，不满足时返回第一个不满足的 Header
+func (p *ProxyMiddleware) matchHeaders(c *app.RequestContext, conditions map[string]*config.ValueCondition) (string, bool) {
+	for key, cond := range conditions {
+		value := c.Request.Header.Peek(key)
+		if !cond.MatchOrEmpty(string(value), value != nil) {
+			return key, false
 		}
 	}
-	return true
+	return "", true
 }
 
-// matchBody 匹配请求体（仅支持 JSON）
-func (p *ProxyMiddleware) matchBody(c *app.RequestContext, conditions map[string]string) bool {
-	bodyBytes := c.Request.BodyBytes()
-	if len(bodyBytes) == 0 {
-		return false
+// matchQuery 匹配查询参数，不满足时返回第一个不满足的参数
+func (p *ProxyMiddleware) matchQuery(c *app.RequestContext, conditions map[string]*config.ValueCondition) (string, bool) {
+	for key, cond := range conditions {
+		value, exists := c.GetQuery(key)
+		if !cond.MatchOrEmpty(value, exists) {
+			return key, false
+		}
 	}
+	return "", true
+}
 
-	var bodyMap map[string]interface{}
-	if err := json.Unmarshal(bodyBytes, &bodyMap); err != nil {
-		return false
+// matchBody 匹配请求体，按 Content-Type 选择解析方式：
+// JSON 的键为 gjson 路径，如 user.tier、items.#.sku；表单的键为字段名；XML 的键为类 XPath 选择器，如 /order/@id
+// 不满足时返回第一个不满足的键
+func (p *ProxyMiddleware) matchBody(body *requestBody, conditions map[string]*config.ValueCondition) (string, bool) {
+	switch body.Kind() {
+	case bodyKindForm:
+		form := body.Form()
+		for name, cond := range conditions {
+			if !matchValues(cond, form[name]) {
+				return name, false
+			}
+		}
+	case bodyKindXML:
+		doc := body.XML()
+		for selector, cond := range conditions {
+			var values []string
+			if doc != nil {
+				values = doc.Select(selector)
+			}
+			if !matchValues(cond, values) {
+				return selector, false
+			}
+		}
+	default:
+		doc := body.JSON()
+		for path, cond := range conditions {
+			if !matchJSONValue(cond, doc.Get(path), strings.Contains(path, "#")) {
+				return path, false
+			}
+		}
 	}
 
-	for key, value := range conditions {
-		if bodyValue, ok := bodyMap[key]; !ok {
-			return false
-		} else {
-			if fmt.Sprintf("%v", bodyValue) != value {
-				return false
+	return "", true
+}
+
+// matchGraphQL 匹配 GraphQL 操作，请求不是 GraphQL 或解析失败时不匹配，不满足时返回原因
+func (p *ProxyMiddleware) matchGraphQL(body *requestBody, conditions *config.GraphQLMatch) (string, bool) {
+	op := body.GraphQL()
+	if op == nil {
+		return "不是 GraphQL 请求", false
+	}
+
+	if conditions.OperationName != nil && !conditions.OperationName.Match(op.Name, op.Name != "") {
+		return "GraphQL 操作名不满足条件", false
+	}
+	if conditions.OperationType != "" && conditions.OperationType != op.Type {
+		return "GraphQL 操作类型不是 " + conditions.OperationType, false
+	}
+	if len(conditions.Fields) > 0 {
+		for _, field := range conditions.Fields {
+			for _, selected := range op.Fields {
+				if field == selected {
+					return "", true
+				}
 			}
 		}
+		return "GraphQL 顶层字段不包含 " + strings.Join(conditions.Fields, "、"), false
 	}
-
-	return true
+	return "", true
 }
 
-// proxyRequest 执行代理请求
-func (p *ProxyMiddleware) proxyRequest(ctx context.Context, c *app.RequestContext, rule *config.ProxyRule) (int, string, error) {
-	// 构建目标 URL
-	targetURL := rule.Target
-	path := string(c.Path())
+// matchValues 匹配可能有多个值的字段，任意一个值满足条件即可，没有值时视为不存在
+// 取反时要求所有值都不满足原条件
+func matchValues(cond *config.ValueCondition, values []string) bool {
+	if len(values) == 0 {
+		return cond.Match("", false)
+	}
+	for _, value := range values {
+		if cond.Match(value, true) != cond.Negate {
+			return !cond.Negate
+		}
+	}
+	return cond.Negate
+}
 
-	// 路径重写
-	if rule.RewritePath != "" {
-		path = strings.Replace(path, rule.Match.Path, rule.RewritePath, 1)
+// matchJSONValue 按 JSON 类型匹配字段值
+// 数字按数值比较，字符串去掉引号比较，对象和数组按原文比较；
+// 路径中带 # 查询多个元素时，任意一个元素满足条件即可
+func matchJSONValue(cond *config.ValueCondition, result gjson.Result, multi bool) bool {
+	if multi && result.IsArray() && cond.Op != config.OpExists && cond.Op != config.OpNotExists {
+		elements := result.Array()
+		// 取反时要求所有元素都不满足原条件
+		for _, element := range elements {
+			if matchJSONValue(cond, element, false) != cond.Negate {
+				return !cond.Negate
+			}
+		}
+		return cond.Negate
 	}
-	targetURL = strings.TrimSuffix(targetURL, "/") + path
 
-	// 添加查询参数
-	queryArgs := c.QueryArgs()
-	if queryArgs.Len() > 0 {
-		targetURL += "?" + string(queryArgs.QueryString())
+	if !result.Exists() {
+		return cond.Match("", false)
+	}
+	switch result.Type {
+	case gjson.Number:
+		return cond.MatchNumber(result.Raw)
+	case gjson.String:
+		return cond.Match(result.Str, true)
+	case gjson.JSON:
+		return cond.Match(result.Raw, true)
+	default:
+		// true、false、null
+		return cond.Match(result.Raw, true)
 	}
+}
+
+// proxyRequest 执行代理请求
+// 返回上游响应（响应体由调用方流式读取），release 用于在响应体读取结束后释放请求资源
+// uri 为重写后的路径和查询参数
+func (p *ProxyMiddleware) proxyRequest(ctx context.Context, c *app.RequestContext, rule *config.ProxyRule, target, uri string, vars *templateVars, body io.Reader, contentLength int64) (*http.Response, func(), error) {
+	// 构建目标 URL
+	targetURL := buildTargetURL(target, uri)
 
 	// 创建请求
-	timeout := time.Duration(rule.Timeout) * time.Second
-	if timeout == 0 {
-		timeout = 30 * time.Second
+	timeout := ruleTimeout(rule)
+
+	// 超时覆盖整个请求（包括响应体传输），SSE 在收到响应头后取消超时
+	reqCtx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(timeout, cancel)
+	release := func() {
+		timer.Stop()
+		cancel()
 	}
 
-	reqCtx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(reqCtx, string(c.Method()), targetURL, bytes.NewReader(c.Request.BodyBytes()))
+	if contentLength == 0 {
+		body = http.NoBody
+	}
+	req, err := http.NewRequestWithContext(reqCtx, string(c.Method()), targetURL, body)
 	if err != nil {
-		return 0, "", fmt.Errorf("创建请求失败: %w", err)
+		release()
+		return nil, nil, fmt.Errorf("创建请求失败: %w", err)
 	}
+	req.ContentLength = contentLength
 
-	// 复制请求头
-	c.Request.Header.VisitAll(func(key, value []byte) {
-		req.Header.Add(string(key), string(value))
-	})
-
-	// 添加额外请求头
-	for key, value := range rule.Headers {
-		req.Header.Set(key, value)
+	// 复制请求头，添加额外请求头并执行请求转换
+	req.Header = requestHeader(c, rule, vars)
+	if rule.PreserveHost {
+		req.Host = string(c.Host())
 	}
 
 	// 检查请求是否是 SSE 请求
 	isSSERequest := strings.Contains(strings.ToLower(req.Header.Get("Accept")), "text/event-stream")
 
-	// 发送请求
-	client := &http.Client{
-		Timeout: timeout,
+	// 发送请求（同一目标和连接池配置共享连接）
+	transport, err := p.transports.get(target, rule)
+	if err != nil {
+		release()
+		return nil, nil, err
 	}
-
-	resp, err := client.Do(req)
+	resp, err := transport.do(req)
 	if err != nil {
-		return 0, "", fmt.Errorf("请求失败: %w", err)
+		// 计时器已经触发说明是超时取消，等待响应头超时等也视为超时
+		var netErr net.Error
+		if !timer.Stop() || (errors.As(err, &netErr) && netErr.Timeout()) {
+			err = fmt.Errorf("%w: %v", errUpstreamTimeout, err)
+		}
+		release()
+		return nil, nil, fmt.Errorf("请求失败: %w", err)
 	}
-	defer resp.Body.Close()
-
-	// 检查响应是否是 SSE
-	isSSEResponse := strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "text/event-stream")
-	isSSE := isSSERequest || isSSEResponse
 
-	// 如果是 SSE，需要流式传输
-	if isSSE {
-		// 复制响应头
-		for key, values := range resp.Header {
-			for _, value := range values {
-				c.Header(key, value)
-			}
-		}
+	// SSE 是长连接，不受超时限制
+	if isSSERequest || isSSEResponse(resp) {
+		timer.Stop()
+	}
 
-		// 设置状态码
-		c.Status(resp.StatusCode)
+	return resp, release, nil
+}
 
-		// 流式传输响应体
-		buffer := make([]byte, 4096)
-		for {
-			n, err := resp.Body.Read(buffer)
-			if n > 0 {
-				c.Write(buffer[:n])
-				c.Flush()
-			}
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return resp.StatusCode, "", fmt.Errorf("读取响应流失败: %w", err)
-			}
-		}
-		return resp.StatusCode, "[SSE Stream]", nil
-	}
+// buildTargetURL 构建目标 URL，uri 为重写后的路径和查询参数
+func buildTargetURL(target, uri string) string {
+	return strings.TrimSuffix(target, "/") + uri
+}
 
-	// 读取响应体
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0, "", fmt.Errorf("读取响应失败: %w", err)
+// ruleTimeout 返回规则的超时时间，未配置时默认 30 秒
+func ruleTimeout(rule *config.ProxyRule) time.Duration {
+	timeout := time.Duration(rule.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 30 * time.Second
 	}
+	return timeout
+}
 
-	return resp.StatusCode, string(bodyBytes), nil
+// isSSEResponse 检查响应是否是 SSE
+func isSSEResponse(resp *http.Response) bool {
+	return strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "text/event-stream")
 }
 
 // extractHeaders 提取请求头
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// TestMatchCondition 运算符与 all、any、not 子条件组合后的匹配结果
+func TestMatchCondition(t *testing.T) {
+	cfg := loadTestConfig(t, `proxy:
+  rules:
+    - name: legacy-empty
+      match:
+        path: /legacy
+        headers:
+          X-Foo: ""
+        query:
+          page: ""
+      target: http://127.0.0.1:8080
+    - name: operators
+      match:
+        path: /ops
+        headers:
+          X-Env: {op: prefix, value: beta, ignore_case: true}
+          X-Debug: {op: not_exists}
+        query:
+          version: {op: gte, value: "2"}
+      target: http://127.0.0.1:8080
+    - name: groups
+      match:
+        path: /groups/{id}
+        path_type: glob
+        all:
+          - headers:
+              X-Tenant: {op: exists}
+        any:
+          - headers:
+              X-Role: admin
+          - query:
+              token: {op: regex, value: "^[a-f0-9]{8}$"}
+        not:
+          headers:
+            X-Blocked: "true"
+      target: http://127.0.0.1:8080
+    - name: body-empty
+      match:
+        path: /body
+        body:
+          note: ""
+      target: http://127.0.0.1:8080
+    - name: body-missing
+      match:
+        path: /body
+        body:
+          note: {op: not_exists}
+          tag: {value: internal, negate: true}
+      target: http://127.0.0.1:8080
+`)
+
+	tests := []struct {
+		name    string
+		rule    int
+		uri     string
+		headers map[string]string
+		body    string
+		want    bool
+	}{
+		{"旧版空值匹配缺失的 Header 和参数", 0, "/legacy", nil, "", true},
+		{"旧版空值匹配空的 Header 和参数", 0, "/legacy?page=", map[string]string{"X-Foo": ""}, "", true},
+		{"旧版空值不匹配非空 Header", 0, "/legacy", map[string]string{"X-Foo": "bar"}, "", false},
+		{"旧版空值不匹配非空参数", 0, "/legacy?page=2", nil, "", false},
+		{"运算符全部满足", 1, "/ops?version=2.5", map[string]string{"X-Env": "BETA-1"}, "", true},
+		{"数值不满足", 1, "/ops?version=1", map[string]string{"X-Env": "beta"}, "", false},
+		{"前缀不满足", 1, "/ops?version=3", map[string]string{"X-Env": "prod"}, "", false},
+		{"not_exists 不满足", 1, "/ops?version=3", map[string]string{"X-Env": "beta", "X-Debug": ""}, "", false},
+		{"any 第一个满足", 2, "/groups/1", map[string]string{"X-Tenant": "t", "X-Role": "admin"}, "", true},
+		{"any 第二个满足", 2, "/groups/1?token=deadbeef", map[string]string{"X-Tenant": "t"}, "", true},
+		{"any 都不满足", 2, "/groups/1?token=nothex00", map[string]string{"X-Tenant": "t", "X-Role": "user"}, "", false},
+		{"all 不满足", 2, "/groups/1", map[string]string{"X-Role": "admin"}, "", false},
+		{"not 满足时不匹配", 2, "/groups/1", map[string]string{"X-Tenant": "t", "X-Role": "admin", "X-Blocked": "true"}, "", false},
+		{"not 不满足时匹配", 2, "/groups/1", map[string]string{"X-Tenant": "t", "X-Role": "admin", "X-Blocked": "false"}, "", true},
+		{"Body 空值匹配空字符串", 3, "/body", nil, `{"note":""}`, true},
+		{"Body 空值不匹配缺失的键", 3, "/body", nil, `{"other":1}`, false},
+		{"Body 空值不匹配空请求体", 3, "/body", nil, "", false},
+		{"Body 空值不匹配缺失的表单字段", 3, "/body", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, "other=1", false},
+		{"Body not_exists 和取反匹配缺失的键", 4, "/body", nil, `{"other":1}`, true},
+		{"Body not_exists 不满足", 4, "/body", nil, `{"note":""}`, false},
+	}
+	p := &ProxyMiddleware{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := app.NewContext(0)
+			c.Request.SetRequestURI(tt.uri)
+			for key, value := range tt.headers {
+				c.Request.Header.Set(key, value)
+			}
+			if tt.body != "" {
+				c.Request.Header.SetMethod("POST")
+				if len(tt.headers["Content-Type"]) == 0 {
+					c.Request.Header.SetContentTypeBytes([]byte("application/json"))
+				}
+			}
+			var why string
+			_, ok := p.matchCondition(c, &cfg.Proxy.Rules[tt.rule].Match, benchmarkBody(c, []byte(tt.body)), &why)
+			if ok != tt.want {
+				t.Errorf("got %v (%s), want %v", ok, why, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/without-php/BFF-proxy/internal/config"
+	"github.com/without-php/BFF-proxy/internal/logger"
+)
+
+// errUpstreamTimeout 上游请求超过规则的超时时间
+var errUpstreamTimeout = errors.New("上游请求超时")
+
+// retryBudgetWindow 重试预算的统计窗口
+const retryBudgetWindow = 10 * time.Second
+
+// upstreamResponse 转发成功的上游响应
+type upstreamResponse struct {
+	*http.Response
+	release func() // 响应体读取结束后释放请求资源
+	done    func() // 结束目标的活跃请求计数
+}
+
+// forward 转发请求，按规则的重试策略重试，每次重试重新选择上游目标
+// 返回错误时已经结束了活跃请求计数，reqLog.Target 为最后一次尝试的目标；probe 为选中 target 时熔断器的探测轮次
+func (p *ProxyMiddleware) forward(ctx context.Context, c *app.RequestContext, rule *config.ProxyRule, target string, probe int, uri string, vars *templateVars, done func(), body *requestBody, capture *bodyCapture, reqLog *logger.RequestLog) (*upstreamResponse, error) {
+	policy := rule.Retry
+	maxAttempts := 1
+	if policy != nil && policy.Attempts > 1 && retryMethodAllowed(policy, string(c.Method())) {
+		// 重试需要重放请求体，只有能完整预读的请求体才能重试
+		body.Peek()
+		if body.peekedAll {
+			maxAttempts = policy.Attempts
+		}
+		p.retries.request(rule.Name)
+	}
+
+	for attempt := 1; ; attempt++ {
+		reqLog.Target = target
+
+		reader := body.Reader()
+		if attempt == 1 {
+			reader = io.TeeReader(reader, capture)
+		}
+
+		attemptLog := logger.AttemptLog{Attempt: attempt, Target: target, StartTime: time.Now()}
+		resp, release, err := p.proxyRequest(ctx, c, rule, target, uri, vars, reader, body.ContentLength())
+		attemptLog.Duration = time.Since(attemptLog.StartTime)
+
+		retryable := false
+		if err != nil {
+			p.health.report(target, rule.HealthCheck, false, err.Error())
+			p.breakers.record(target, rule.Breaker, probe, false, attemptLog.Duration)
+			attemptLog.Error = err.Error()
+			retryable = isRetryableError(policy, err)
+		} else {
+			success := !isFailureStatus(resp.StatusCode)
+			p.health.report(target, rule.HealthCheck, success, fmt.Sprintf("上游返回状态码 %d", resp.StatusCode))
+			p.breakers.record(target, rule.Breaker, probe, success, attemptLog.Duration)
+			attemptLog.StatusCode = resp.StatusCode
+			retryable = isRetryableStatus(policy, resp.StatusCode)
+		}
+
+		// 判断是否重试：还有剩余次数、客户端没有取消、有可用目标且预算充足
+		next := ""
+		var nextDone func()
+		nextProbe := 0
+		if retryable && attempt < maxAttempts && ctx.Err() == nil {
+			if picked, pickedDone, pickedProbe, pickErr := p.balancer.pick(c, rule); pickErr == nil {
+				if p.retries.allow(rule.Name, policy) {
+					next, nextDone, nextProbe = picked, pickedDone, pickedProbe
+				} else {
+					pickedDone()
+				}
+			}
+		}
+
+		if next == "" {
+			if policy != nil {
+				reqLog.Attempts = append(reqLog.Attempts, attemptLog)
+			}
+			if err != nil {
+				done()
+				return nil, err
+			}
+			return &upstreamResponse{Response: resp, release: release, done: done}, nil
+		}
+
+		// 放弃本次响应，退避后重试
+		if resp != nil {
+			resp.Body.Close()
+			release()
+		}
+		done()
+
+		attemptLog.Backoff = retryBackoff(policy, attempt)
+		reqLog.Attempts = append(reqLog.Attempts, attemptLog)
+		select {
+		case <-ctx.Done():
+			nextDone()
+			return nil, fmt.Errorf("等待重试时请求被取消: %w", ctx.Err())
+		case <-time.After(attemptLog.Backoff):
+		}
+
+		target, done, probe = next, nextDone, nextProbe
+	}
+}
+
+// retryMethodAllowed 判断请求方法是否允许重试，默认只重试幂等方法
+func retryMethodAllowed(policy *config.RetryConfig, method string) bool {
+	if policy.NonIdempotent {
+		return true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// isRetryableError 判断转发错误是否可以重试
+func isRetryableError(policy *config.RetryConfig, err error) bool {
+	if policy == nil {
+		return false
+	}
+
+	on := policy.On
+	if len(on) == 0 && len(policy.StatusCodes) == 0 {
+		on = []string{config.RetryOnConnectError, config.RetryOnTimeout}
+	}
+
+	var opErr *net.OpError
+	for _, condition := range on {
+		switch condition {
+		case config.RetryOnConnectError:
+			if errors.As(err, &opErr) && opErr.Op == "dial" {
+				return true
+			}
+		case config.RetryOnTimeout:
+			if errors.Is(err, errUpstreamTimeout) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isRetryableStatus 判断上游状态码是否可以重试
+func isRetryableStatus(policy *config.RetryConfig, statusCode int) bool {
+	if policy == nil {
+		return false
+	}
+	for _, code := range policy.StatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// retryBackoff 计算第 attempt 次尝试失败后的退避时间：指数增长，上限为 backoff_max，一半随机抖动
+func retryBackoff(policy *config.RetryConfig, attempt int) time.Duration {
+	base := time.Duration(policy.BackoffBase) * time.Millisecond
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	maxBackoff := time.Duration(policy.BackoffMax) * time.Millisecond
+	if maxBackoff <= 0 {
+		maxBackoff = 2 * time.Second
+	}
+
+	backoff := base
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// retryBudget 重试预算，按规则统计固定窗口内的请求数和重试次数，防止重试放大故障
+type retryBudget struct {
+	mu      sync.Mutex
+	windows map[string]*budgetWindow // 规则名 -> 当前窗口
+}
+
+// budgetWindow 单个规则的预算窗口
+type budgetWindow struct {
+	start    time.Time
+	requests int
+	retries  int
+}
+
+// newRetryBudget 创建重试预算
+func newRetryBudget() *retryBudget {
+	return &retryBudget{windows: make(map[string]*budgetWindow)}
+}
+
+// window 返回规则的当前窗口，过期时重新开始（需要先获取锁）
+func (b *retryBudget) window(ruleName string) *budgetWindow {
+	w, ok := b.windows[ruleName]
+	if !ok || time.Since(w.start) > retryBudgetWindow {
+		w = &budgetWindow{start: time.Now()}
+		b.windows[ruleName] = w
+	}
+	return w
+}
+
+// request 记录一次可重试的请求
+func (b *retryBudget) request(ruleName string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.window(ruleName).requests++
+}
+
+// allow 判断是否还有重试预算，有则占用一次
+func (b *retryBudget) allow(ruleName string, policy *config.RetryConfig) bool {
+	percent := policy.BudgetPercent
+	if percent <= 0 {
+		percent = 20
+	}
+	minRetries := policy.BudgetMinRetries
+	if minRetries <= 0 {
+		minRetries = 3
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w := b.window(ruleName)
+	if w.retries >= minRetries && w.retries*100 >= w.requests*percent {
+		return false
+	}
+	w.retries++
+	return true
+}
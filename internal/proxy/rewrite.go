@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"os"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// templateVars 模板变量的取值来源，每个请求创建一次
+type templateVars struct {
+	c          *app.RequestContext
+	pathParams map[string]string // 路径匹配的命名捕获
+	client     *clientConn
+	requestID  string
+}
+
+// rewriteRequestURI 按规则重写请求路径和查询参数，返回转发给上游的 URI（路径 + 查询参数）
+func rewriteRequestURI(rule *config.ProxyRule, vars *templateVars) string {
+	c := vars.c
+	path := string(c.Path())
+
+	// 旧的 rewrite_path 配置
+	if rule.RewritePath != "" {
+		path = rule.Match.RewritePath(path, rule.RewritePath)
+	}
+
+	query := &protocol.Args{}
+	c.QueryArgs().CopyTo(query)
+
+	if rewrite := rule.Rewrite; rewrite != nil {
+		path = rewrite.RewritePath(path, vars.lookup)
+	}
+
+	// 重写结果中带有查询参数时合并到原有查询参数中
+	if before, after, ok := strings.Cut(path, "?"); ok {
+		path = before
+		extra := &protocol.Args{}
+		extra.ParseBytes([]byte(after))
+		extra.VisitAll(func(key, value []byte) {
+			query.Add(string(key), string(value))
+		})
+	}
+
+	if rewrite := rule.Rewrite; rewrite != nil {
+		if rewrite.Query != nil {
+			rewriteQuery(query, rewrite.Query, vars)
+		}
+	}
+	if rule.Transform != nil {
+		transformQuery(query, rule.Transform.Request, vars)
+	}
+
+	if query.Len() > 0 {
+		return path + "?" + string(query.QueryString())
+	}
+	return path
+}
+
+// rewriteQuery 按 remove、rename、set 的顺序重写查询参数
+func rewriteQuery(query *protocol.Args, rewrite *config.QueryRewrite, vars *templateVars) {
+	for _, key := range rewrite.Remove {
+		query.Del(key)
+	}
+	for from, to := range rewrite.Rename {
+		values := query.PeekAll(from)
+		if len(values) == 0 {
+			continue
+		}
+		copied := make([]string, len(values))
+		for i, value := range values {
+			copied[i] = string(value)
+		}
+		query.Del(from)
+		for _, value := range copied {
+			query.Add(to, value)
+		}
+	}
+	for key, template := range rewrite.SetTemplates() {
+		query.Set(key, template.Render(vars.lookup))
+	}
+}
+
+// lookup 返回模板变量的值，不存在时返回空字符串
+// {path} 为原始请求路径，{path.name} 为路径匹配的命名捕获
+func (v *templateVars) lookup(source, name string) string {
+	c := v.c
+	switch source {
+	case config.TemplateSourcePath:
+		if name == "" {
+			return string(c.Path())
+		}
+		return v.pathParams[name]
+	case config.TemplateSourceHeader:
+		return string(c.Request.Header.Peek(name))
+	case config.TemplateSourceQuery:
+		return string(c.QueryArgs().Peek(name))
+	case config.TemplateSourceCookie:
+		return string(c.Cookie(name))
+	case config.TemplateSourceMethod:
+		return string(c.Method())
+	case config.TemplateSourceClientIP:
+		return v.client.ip
+	case config.TemplateSourceRequestID:
+		return v.requestID
+	case config.TemplateSourceEnv:
+		return os.Getenv(name)
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// TestRewriteRequestURI 客户端的值不能通过路径捕获或模板变量引入额外的路径段、查询参数或片段
+func TestRewriteRequestURI(t *testing.T) {
+	cfg := loadTestConfig(t, `proxy:
+  rules:
+    - name: users
+      match:
+        path: /users/{id}
+        path_type: glob
+      target: http://127.0.0.1:8080
+      rewrite:
+        template: /v2/users/{path.id}?source={header.X-Source}
+        query:
+          remove: [debug]
+          rename:
+            uid: user_id
+    - name: files
+      match:
+        path: ^/files/(?P<rest>.+)$
+        path_type: regex
+      target: http://127.0.0.1:8080
+      rewrite:
+        template: /storage/{path.rest}
+    - name: legacy
+      match:
+        path: /legacy
+      target: http://127.0.0.1:8080
+      rewrite_path: /v1
+`)
+
+	tests := []struct {
+		name    string
+		rule    int
+		uri     string
+		headers map[string]string
+		want    string
+	}{
+		{"模板", 0, "/users/1", map[string]string{"X-Source": "web"}, "/v2/users/1?source=web"},
+		{"捕获中的 %3F", 0, "/users/1%3Fadmin=true", nil, "/v2/users/1%3Fadmin=true?source="},
+		{"捕获中的 %23", 0, "/users/1%23frag", nil, "/v2/users/1%23frag?source="},
+		{"请求头不能引入查询参数", 0, "/users/1", map[string]string{"X-Source": "web&admin=true"}, "/v2/users/1?source=web%26admin%3Dtrue"},
+		{"查询参数重写", 0, "/users/1?debug=1&uid=7", nil, "/v2/users/1?source=&user_id=7"},
+		{"多段捕获", 1, "/files/a/b%20c%3Fx", nil, "/storage/a/b%20c%3Fx"},
+		{"旧的 rewrite_path", 2, "/legacy/users?page=2", nil, "/v1/users?page=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &cfg.Proxy.Rules[tt.rule]
+			c := app.NewContext(0)
+			c.Request.SetRequestURI(tt.uri)
+			for key, value := range tt.headers {
+				c.Request.Header.Set(key, value)
+			}
+			params, ok := rule.Match.MatchPath(string(c.Path()))
+			if !ok {
+				t.Fatalf("路径 %s 没有匹配规则 %s", c.Path(), rule.Name)
+			}
+
+			vars := &templateVars{c: c, pathParams: params, client: &clientConn{}}
+			if got := rewriteRequestURI(rule, vars); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
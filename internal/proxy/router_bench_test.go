@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// benchmarkConfig 生成 n 个功能分支规则的配置：每个分支一个路径前缀规则和一个按 Body 匹配的规则，
+// 最后是兜底规则，请求命中最后一个分支
+func benchmarkConfig(b *testing.B, n int) *config.Config {
+	b.Helper()
+
+	var yaml strings.Builder
+	yaml.WriteString("proxy:\n  rules:\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&yaml, `    - name: feature-%[1]d-vip
+      match:
+        path: /feature-%[1]d/api
+        path_type: segment
+        headers:
+          X-Env: {op: prefix, value: beta}
+        body:
+          user.tier: vip
+          items.#.qty: {op: gte, value: "%[1]d"}
+      target: http://127.0.0.1:19001
+    - name: feature-%[1]d
+      match:
+        path: /feature-%[1]d/api/{resource}/**
+        path_type: glob
+      target: http://127.0.0.1:19002
+`, i)
+	}
+	yaml.WriteString("    - name: default\n      match:\n        path: /\n      target: http://127.0.0.1:19003\n")
+
+	path := filepath.Join(b.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml.String()), 0644); err != nil {
+		b.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return cfg
+}
+
+// benchmarkRequest 创建命中最后一个分支 Body 规则的请求
+func benchmarkRequest(n int) (*app.RequestContext, []byte) {
+	c := app.NewContext(0)
+	c.Request.Header.SetMethod("POST")
+	c.Request.SetRequestURI(fmt.Sprintf("/feature-%d/api/orders/1", n-1))
+	c.Request.Header.Set("X-Env", "beta-2")
+	c.Request.Header.SetContentTypeBytes([]byte("application/json"))
+	payload := []byte(fmt.Sprintf(`{"user":{"id":42,"tier":"vip"},"items":[{"sku":"a","qty":1},{"sku":"b","qty":%d}]}`, n))
+	return c, payload
+}
+
+// benchmarkBody 创建与转发时相同的流式请求体
+func benchmarkBody(c *app.RequestContext, payload []byte) *requestBody {
+	return &requestBody{
+		stream:        bytes.NewReader(payload),
+		contentLength: len(payload),
+		contentType:   string(c.Request.Header.ContentType()),
+		query:         c.QueryArgs(),
+	}
+}
+
+// linearMatch 不使用路由表，按匹配顺序逐个匹配所有规则，作为对比
+func linearMatch(p *ProxyMiddleware, c *app.RequestContext, cfg *config.Config, body *requestBody) *config.ProxyRule {
+	for _, i := range cfg.Proxy.RuleOrder() {
+		if _, ok := p.matchCondition(c, &cfg.Proxy.Rules[i].Match, body, nil); ok {
+			return &cfg.Proxy.Rules[i]
+		}
+	}
+	return nil
+}
+
+// BenchmarkFindMatchingRule 请求命中最后一个分支的 Body 规则，对比路由表和逐个匹配的耗时
+func BenchmarkFindMatchingRule(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		cfg := benchmarkConfig(b, n)
+		c, payload := benchmarkRequest(n)
+		p := &ProxyMiddleware{}
+
+		want := fmt.Sprintf("feature-%d-vip", n-1)
+		if rule, _ := p.findMatchingRule(c, cfg, benchmarkBody(c, payload)); rule == nil || rule.Name != want {
+			b.Fatalf("rules=%d: 匹配到 %v，期望 %s", n, rule, want)
+		}
+
+		b.Run(fmt.Sprintf("routes/rules=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p.findMatchingRule(c, cfg, benchmarkBody(c, payload))
+			}
+		})
+		b.Run(fmt.Sprintf("linear/rules=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				linearMatch(p, c, cfg, benchmarkBody(c, payload))
+			}
+		})
+	}
+}
+
+// BenchmarkFindMatchingRuleDefault 请求不属于任何分支，由最后的兜底规则处理
+func BenchmarkFindMatchingRuleDefault(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		cfg := benchmarkConfig(b, n)
+		c := app.NewContext(0)
+		c.Request.Header.SetMethod("GET")
+		c.Request.SetRequestURI("/static/app.js")
+		p := &ProxyMiddleware{}
+
+		b.Run(fmt.Sprintf("routes/rules=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				p.findMatchingRule(c, cfg, benchmarkBody(c, nil))
+			}
+		})
+		b.Run(fmt.Sprintf("linear/rules=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				linearMatch(p, c, cfg, benchmarkBody(c, nil))
+			}
+		})
+	}
+}
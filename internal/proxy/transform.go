@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// requestHeader 返回转发给上游的请求头：复制客户端的请求头，再添加规则的额外请求头并执行请求转换
+func requestHeader(c *app.RequestContext, rule *config.ProxyRule, vars *templateVars) http.Header {
+	header := make(http.Header)
+	c.Request.Header.VisitAll(func(key, value []byte) {
+		header.Add(string(key), string(value))
+	})
+	applyRequestHeaders(header, rule, vars)
+	return header
+}
+
+// applyRequestHeaders 删除逐跳头部和 Host，设置转发请求头，添加规则的额外请求头，再按顺序执行请求的头部和 Cookie 转换步骤
+// 转发给上游的 Host 由规则的 preserve_host 决定，通过 http.Request.Host 设置
+func applyRequestHeaders(header http.Header, rule *config.ProxyRule, vars *templateVars) {
+	removeHopHeaders(header)
+	header.Del("Host")
+	vars.client.setForwardingHeaders(header)
+	for key, value := range rule.Headers {
+		header.Set(key, value)
+	}
+	if rule.Transform != nil {
+		transformHeader(header, rule.Transform.Request, vars, false)
+	}
+}
+
+// transformResponseHeader 按顺序执行响应的转换步骤，返回转换后的响应头（副本），没有响应步骤时原样返回
+func transformResponseHeader(header http.Header, rule *config.ProxyRule, vars *templateVars) http.Header {
+	if rule.Transform == nil || len(rule.Transform.Response) == 0 {
+		return header
+	}
+	header = header.Clone()
+	transformHeader(header, rule.Transform.Response, vars, true)
+	return header
+}
+
+// transformHeader 执行头部和 Cookie 转换步骤，查询参数步骤由 transformQuery 执行
+// 请求的 Cookie 步骤操作 Cookie 请求头，响应的 Cookie 步骤操作 Set-Cookie 响应头
+func transformHeader(header http.Header, steps []config.TransformStep, vars *templateVars, response bool) {
+	for i := range steps {
+		step := &steps[i]
+		switch {
+		case step.Header != "":
+			transformHeaderValues(header, step, vars)
+		case step.Cookie != "" && response:
+			transformSetCookie(header, step, vars)
+		case step.Cookie != "":
+			transformCookie(header, step, vars)
+		}
+	}
+}
+
+// transformHeaderValues 执行一个头部转换步骤
+func transformHeaderValues(header http.Header, step *config.TransformStep, vars *templateVars) {
+	switch step.Action {
+	case config.TransformSet:
+		header.Set(step.Header, step.RenderValue(vars.lookup))
+	case config.TransformAdd:
+		header.Add(step.Header, step.RenderValue(vars.lookup))
+	case config.TransformRemove:
+		header.Del(step.Header)
+	case config.TransformRename:
+		values := header.Values(step.Header)
+		header.Del(step.Header)
+		for _, value := range values {
+			header.Add(step.To, value)
+		}
+	case config.TransformReplace:
+		values := header.Values(step.Header)
+		for i, value := range values {
+			values[i] = step.ReplaceValue(value)
+		}
+	}
+}
+
+// cookiePair Cookie 请求头中的一项
+type cookiePair struct {
+	name  string
+	value string
+}
+
+// transformCookie 执行一个请求 Cookie 转换步骤，修改后重新生成 Cookie 请求头
+func transformCookie(header http.Header, step *config.TransformStep, vars *templateVars) {
+	var pairs []cookiePair
+	for _, line := range header.Values("Cookie") {
+		for _, part := range strings.Split(line, ";") {
+			if part = strings.TrimSpace(part); part != "" {
+				name, value, _ := strings.Cut(part, "=")
+				pairs = append(pairs, cookiePair{name: name, value: value})
+			}
+		}
+	}
+
+	switch step.Action {
+	case config.TransformAdd:
+		// 同名 Cookie 只保留新添加的值
+		pairs = slices.DeleteFunc(pairs, func(pair cookiePair) bool { return pair.name == step.Cookie })
+		pairs = append(pairs, cookiePair{name: step.Cookie, value: step.RenderValue(vars.lookup)})
+	case config.TransformRemove:
+		pairs = slices.DeleteFunc(pairs, func(pair cookiePair) bool { return pair.name == step.Cookie })
+	case config.TransformRewrite:
+		for i := range pairs {
+			if pairs[i].name == step.Cookie {
+				pairs[i].name, pairs[i].value = rewriteCookie(pairs[i].name, pairs[i].value, step, vars)
+			}
+		}
+	}
+
+	header.Del("Cookie")
+	if len(pairs) > 0 {
+		parts := make([]string, len(pairs))
+		for i, pair := range pairs {
+			parts[i] = pair.name + "=" + pair.value
+		}
+		header.Set("Cookie", strings.Join(parts, "; "))
+	}
+}
+
+// transformSetCookie 执行一个响应 Cookie 转换步骤
+// add 追加一条 Set-Cookie；remove、rewrite 处理所有同名的 Set-Cookie，无法解析的 Set-Cookie 保持原样
+func transformSetCookie(header http.Header, step *config.TransformStep, vars *templateVars) {
+	if step.Action == config.TransformAdd {
+		cookie := &http.Cookie{Name: step.Cookie, Value: step.RenderValue(vars.lookup)}
+		setCookieAttributes(cookie, step)
+		if line := cookie.String(); line != "" {
+			header.Add("Set-Cookie", line)
+		}
+		return
+	}
+
+	var lines []string
+	for _, line := range header.Values("Set-Cookie") {
+		cookie, err := http.ParseSetCookie(line)
+		if err != nil || cookie.Name != step.Cookie {
+			lines = append(lines, line)
+			continue
+		}
+		if step.Action == config.TransformRemove {
+			continue
+		}
+		cookie.Name, cookie.Value = rewriteCookie(cookie.Name, cookie.Value, step, vars)
+		setCookieAttributes(cookie, step)
+		if line = cookie.String(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	header.Del("Set-Cookie")
+	for _, line := range lines {
+		header.Add("Set-Cookie", line)
+	}
+}
+
+// rewriteCookie 按 rewrite 步骤返回新的 Cookie 名称和值：先用 value 替换，再按 regex 替换，最后改名
+func rewriteCookie(name, value string, step *config.TransformStep, vars *templateVars) (string, string) {
+	if step.Value != "" {
+		value = step.RenderValue(vars.lookup)
+	}
+	value = step.ReplaceValue(value)
+	if step.To != "" {
+		name = step.To
+	}
+	return name, value
+}
+
+// setCookieAttributes 设置响应 Cookie 的属性，未配置的属性保持不变
+func setCookieAttributes(cookie *http.Cookie, step *config.TransformStep) {
+	if step.Domain != nil {
+		cookie.Domain = *step.Domain
+	}
+	if step.Path != nil {
+		cookie.Path = *step.Path
+	}
+	if step.MaxAge != nil {
+		cookie.MaxAge = *step.MaxAge
+		if cookie.MaxAge == 0 {
+			// http.Cookie 中 MaxAge 小于 0 表示输出 Max-Age=0
+			cookie.MaxAge = -1
+		}
+	}
+	if step.Secure != nil {
+		cookie.Secure = *step.Secure
+	}
+	if step.HTTPOnly != nil {
+		cookie.HttpOnly = *step.HTTPOnly
+	}
+	switch step.SameSite {
+	case "Lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "Strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "None":
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+}
+
+// transformQuery 按顺序执行查询参数转换步骤
+func transformQuery(query *protocol.Args, steps []config.TransformStep, vars *templateVars) {
+	for i := range steps {
+		step := &steps[i]
+		if step.Query == "" {
+			continue
+		}
+		switch step.Action {
+		case config.TransformSet:
+			query.Set(step.Query, step.RenderValue(vars.lookup))
+		case config.TransformAdd:
+			query.Add(step.Query, step.RenderValue(vars.lookup))
+		case config.TransformRemove:
+			query.Del(step.Query)
+		}
+	}
+}
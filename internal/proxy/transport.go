@@ -0,0 +1,275 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/without-php/BFF-proxy/internal/config"
+)
+
+// transportRegistry 上游连接池注册表
+// 按（目标地址, 连接池配置, TLS 配置）复用 http.Client，配置变更后不再使用的连接池会关闭空闲连接
+type transportRegistry struct {
+	mu      sync.Mutex
+	entries map[string]*transportEntry // 目标地址|配置 -> 连接池
+}
+
+// transportEntry 单个连接池
+type transportEntry struct {
+	target    string
+	config    config.TransportConfig
+	tls       *tls.Config // 规则的 TLS 配置，未配置时为 nil
+	grpc      bool        // gRPC 连接池，只使用 HTTP/2
+	client    *http.Client
+	transport *http.Transport
+	created   time.Time
+
+	openConns   int64 // 当前打开的连接数
+	dials       int64 // 累计建立的连接数
+	dialErrors  int64 // 累计建立连接失败次数
+	requests    int64 // 累计请求数
+	reusedConns int64 // 累计复用连接的请求数
+	inflight    int64 // 正在进行的请求数（收到响应头之前）
+}
+
+// TransportStatus 连接池状态（用于管理接口）
+type TransportStatus struct {
+	Target      string                 `json:"target"`
+	GRPC        bool                   `json:"grpc,omitempty"` // gRPC 连接池（只使用 HTTP/2）
+	Config      config.TransportConfig `json:"config"`         // 连接池配置（未配置的字段使用默认值）
+	Created     time.Time              `json:"created"`        // 创建时间
+	OpenConns   int64                  `json:"open_conns"`     // 当前打开的连接数（包括空闲连接）
+	Dials       int64                  `json:"dials"`          // 累计建立的连接数
+	DialErrors  int64                  `json:"dial_errors"`    // 累计建立连接失败次数
+	Requests    int64                  `json:"requests"`       // 累计请求数
+	ReusedConns int64                  `json:"reused_conns"`   // 累计复用连接的请求数
+	Inflight    int64                  `json:"inflight"`       // 正在等待响应头的请求数
+}
+
+// newTransportRegistry 创建连接池注册表
+func newTransportRegistry() *transportRegistry {
+	return &transportRegistry{entries: make(map[string]*transportEntry)}
+}
+
+// transportKey 连接池的键
+func transportKey(target string, rule *config.ProxyRule) string {
+	var tlsCfg config.UpstreamTLSConfig
+	if rule.TLS != nil {
+		// 只按配置项区分，同样的 TLS 配置共享连接池
+		tlsCfg = config.UpstreamTLSConfig{
+			CAFile:             rule.TLS.CAFile,
+			CertFile:           rule.TLS.CertFile,
+			KeyFile:            rule.TLS.KeyFile,
+			ServerName:         rule.TLS.ServerName,
+			InsecureSkipVerify: rule.TLS.InsecureSkipVerify,
+		}
+	}
+	return fmt.Sprintf("%s|%+v|%+v", target, withTransportDefaults(rule.Transport), tlsCfg)
+}
+
+// withTransportDefaults 填充连接池配置的默认值
+func withTransportDefaults(cfg *config.TransportConfig) config.TransportConfig {
+	var c config.TransportConfig
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.MaxIdleConnsPerHost <= 0 {
+		c.MaxIdleConnsPerHost = 100
+	}
+	if c.IdleConnTimeout <= 0 {
+		c.IdleConnTimeout = 90
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = 30
+	}
+	if c.TLSHandshakeTimeout <= 0 {
+		c.TLSHandshakeTimeout = 10
+	}
+	if c.KeepAlive <= 0 {
+		c.KeepAlive = 30
+	}
+	return c
+}
+
+// grpcTransportKey gRPC 连接池的键
+func grpcTransportKey(target string, rule *config.ProxyRule) string {
+	return "grpc|" + transportKey(target, rule)
+}
+
+// get 返回规则的目标使用的连接池，不存在时创建
+func (r *transportRegistry) get(target string, rule *config.ProxyRule) (*transportEntry, error) {
+	return r.lookup(transportKey(target, rule), target, rule, false)
+}
+
+// getGRPC 返回规则的目标使用的 gRPC 连接池，不存在时创建
+func (r *transportRegistry) getGRPC(target string, rule *config.ProxyRule) (*transportEntry, error) {
+	return r.lookup(grpcTransportKey(target, rule), target, rule, true)
+}
+
+// lookup 按键查找连接池，不存在时创建
+func (r *transportRegistry) lookup(key, target string, rule *config.ProxyRule, grpc bool) (*transportEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[key]
+	if !ok {
+		tlsConfig, err := rule.TLS.ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("加载上游 TLS 配置失败: %w", err)
+		}
+		entry = newTransportEntry(target, withTransportDefaults(rule.Transport), tlsConfig, grpc)
+		r.entries[key] = entry
+	}
+	return entry, nil
+}
+
+// newTransportEntry 按配置创建连接池
+func newTransportEntry(target string, c config.TransportConfig, tlsConfig *tls.Config, grpc bool) *transportEntry {
+	entry := &transportEntry{target: target, config: c, tls: tlsConfig, grpc: grpc, created: time.Now()}
+
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(c.DialTimeout) * time.Second,
+		KeepAlive: time.Duration(c.KeepAlive) * time.Second,
+	}
+	entry.transport = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           entry.dialContext(dialer),
+		MaxIdleConns:          0, // 只按主机限制
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+		IdleConnTimeout:       time.Duration(c.IdleConnTimeout) * time.Second,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   time.Duration(c.TLSHandshakeTimeout) * time.Second,
+		ResponseHeaderTimeout: time.Duration(c.ResponseHeaderTimeout) * time.Second,
+		ExpectContinueTimeout: time.Second,
+		DisableKeepAlives:     c.DisableKeepAlives,
+		ForceAttemptHTTP2:     !c.DisableHTTP2,
+	}
+	switch {
+	case grpc:
+		// gRPC 只使用 HTTP/2：http:// 目标直接以 h2c 连接，https:// 目标通过 ALPN 协商
+		protocols := new(http.Protocols)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		entry.transport.Protocols = protocols
+		entry.transport.DisableCompression = true
+	case c.DisableHTTP2:
+		// TLSNextProto 为非 nil 的空 map 时不会协商 HTTP/2
+		entry.transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	entry.client = &http.Client{
+		Transport: entry.transport,
+		// 不跟随重定向，由客户端自行处理 Location
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return entry
+}
+
+// dialContext 包装拨号函数，统计连接数
+func (e *transportEntry) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			atomic.AddInt64(&e.dialErrors, 1)
+			return nil, err
+		}
+		atomic.AddInt64(&e.dials, 1)
+		atomic.AddInt64(&e.openConns, 1)
+		return &countedConn{Conn: conn, entry: e}, nil
+	}
+}
+
+// do 发送请求并统计连接复用情况
+func (e *transportEntry) do(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&e.requests, 1)
+	atomic.AddInt64(&e.inflight, 1)
+	defer atomic.AddInt64(&e.inflight, -1)
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.AddInt64(&e.reusedConns, 1)
+			}
+		},
+	}
+	return e.client.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+// countedConn 关闭时减少连接计数
+type countedConn struct {
+	net.Conn
+	entry *transportEntry
+	once  sync.Once
+}
+
+// Close 关闭连接
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		atomic.AddInt64(&c.entry.openConns, -1)
+	})
+	return c.Conn.Close()
+}
+
+// reconcile 配置变更后关闭不再使用的连接池的空闲连接
+// 配置了 TLS 的连接池也会重建，以便重新读取证书文件；正在使用的连接会在请求结束后由连接池自行关闭
+func (r *transportRegistry) reconcile(cfg *config.Config) {
+	wanted := make(map[string]bool)
+	for i := range cfg.Proxy.Rules {
+		rule := &cfg.Proxy.Rules[i]
+		for _, target := range rule.UpstreamTargets() {
+			wanted[transportKey(target.URL, rule)] = true
+			wanted[grpcTransportKey(target.URL, rule)] = true
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, entry := range r.entries {
+		if wanted[key] && entry.tls == nil {
+			continue
+		}
+		entry.transport.CloseIdleConnections()
+		delete(r.entries, key)
+	}
+}
+
+// status 返回所有连接池的状态，按目标地址排序
+func (r *transportRegistry) status() []TransportStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := make([]TransportStatus, 0, len(r.entries))
+	for _, entry := range r.entries {
+		statuses = append(statuses, TransportStatus{
+			Target:      entry.target,
+			GRPC:        entry.grpc,
+			Config:      entry.config,
+			Created:     entry.created,
+			OpenConns:   atomic.LoadInt64(&entry.openConns),
+			Dials:       atomic.LoadInt64(&entry.dials),
+			DialErrors:  atomic.LoadInt64(&entry.dialErrors),
+			Requests:    atomic.LoadInt64(&entry.requests),
+			ReusedConns: atomic.LoadInt64(&entry.reusedConns),
+			Inflight:    atomic.LoadInt64(&entry.inflight),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Target != statuses[j].Target {
+			return statuses[i].Target < statuses[j].Target
+		}
+		return statuses[i].Created.Before(statuses[j].Created)
+	})
+	return statuses
+}
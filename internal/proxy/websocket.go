@@ -0,0 +1,281 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/without-php/BFF-proxy/internal/config"
+	"github.com/without-php/BFF-proxy/internal/logger"
+)
+
+// isWebSocketRequest 判断是否为 WebSocket 握手请求
+func isWebSocketRequest(c *app.RequestContext) bool {
+	return headerHasToken(string(c.GetHeader("Connection")), "upgrade") &&
+		strings.EqualFold(string(c.GetHeader("Upgrade")), "websocket")
+}
+
+// headerHasToken 判断逗号分隔的头部值中是否包含指定 token（不区分大小写）
+func headerHasToken(value, token string) bool {
+	for _, field := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(field), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyWebSocket 转发 WebSocket 连接
+// 先向上游发送握手请求，握手成功后接管客户端连接，双向转发数据帧，连接结束后调用 done
+func (p *ProxyMiddleware) proxyWebSocket(c *app.RequestContext, rule *config.ProxyRule, target string, probe int, uri string, vars *templateVars, reqLog *logger.RequestLog, done func()) {
+	dialStart := time.Now()
+	upstream, upstreamReader, resp, err := p.dialWebSocket(c, rule, target, uri, vars)
+	if err != nil {
+		done()
+		p.health.report(target, rule.HealthCheck, false, err.Error())
+		p.breakers.record(target, rule.Breaker, probe, false, time.Since(dialStart))
+		reqLog.EndTime = time.Now()
+		reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+		reqLog.Error = err.Error()
+
+		// 记录日志
+		logger.LogRequest(reqLog)
+
+		c.JSON(http.StatusBadGateway, map[string]string{
+			"error": fmt.Sprintf("代理请求失败: %v", err),
+		})
+		return
+	}
+
+	p.breakers.record(target, rule.Breaker, probe, !isFailureStatus(resp.StatusCode), time.Since(dialStart))
+
+	// 上游拒绝升级，把响应原样返回给客户端
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer upstream.Close()
+		defer done()
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		copyResponseHeaders(c, transformResponseHeader(resp.Header, rule, vars))
+		c.Status(resp.StatusCode)
+		c.Response.SetBody(body)
+
+		capture := newBodyCapture(config.GetConfig().Log.MaxBodySize)
+		capture.Write(body)
+		reqLog.EndTime = time.Now()
+		reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+		reqLog.StatusCode = resp.StatusCode
+		reqLog.ResponseBody = capture.Format(resp.Header.Get("Content-Type"))
+		if err != nil {
+			reqLog.Error = fmt.Sprintf("读取响应失败: %v", err)
+		}
+
+		// 记录日志
+		logger.LogRequest(reqLog)
+		return
+	}
+
+	// 握手成功，返回 101 并保留 Upgrade 相关头部
+	copyResponseHeaders(c, transformResponseHeader(resp.Header, rule, vars))
+	c.Response.Header.Set("Connection", "Upgrade")
+	c.Response.Header.Set("Upgrade", resp.Header.Get("Upgrade"))
+	c.Status(http.StatusSwitchingProtocols)
+
+	stats := &logger.WebSocketLog{OpenTime: time.Now()}
+	reqLog.StatusCode = http.StatusSwitchingProtocols
+	reqLog.ResponseBody = "[WebSocket]"
+	reqLog.WebSocket = stats
+
+	// 101 响应写出后 Hertz 会把连接交给 hijack 处理函数，连接关闭后记录日志
+	c.Hijack(func(conn network.Conn) {
+		tunnelWebSocket(conn, upstream, upstreamReader, stats)
+		done()
+
+		reqLog.EndTime = time.Now()
+		reqLog.Duration = reqLog.EndTime.Sub(reqLog.StartTime)
+
+		// 记录日志
+		logger.LogRequest(reqLog)
+	})
+}
+
+// dialWebSocket 连接上游并发送 WebSocket 握手请求
+// 返回上游连接、上游读取器（可能已缓冲了部分数据帧）和握手响应
+func (p *ProxyMiddleware) dialWebSocket(c *app.RequestContext, rule *config.ProxyRule, targetAddr, uri string, vars *templateVars) (net.Conn, *bufio.Reader, *http.Response, error) {
+	target, err := url.Parse(buildTargetURL(targetAddr, uri))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("解析目标地址失败: %w", err)
+	}
+
+	timeout := ruleTimeout(rule)
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	switch target.Scheme {
+	case "https", "wss":
+		// 使用规则的 TLS 配置（CA、客户端证书、SNI）
+		transport, tlsErr := p.transports.get(targetAddr, rule)
+		if tlsErr != nil {
+			return nil, nil, nil, tlsErr
+		}
+		tlsConfig := &tls.Config{}
+		if transport.tls != nil {
+			tlsConfig = transport.tls.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = target.Hostname()
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostWithPort(target, "443"), tlsConfig)
+	default:
+		conn, err = dialer.Dial("tcp", hostWithPort(target, "80"))
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("连接上游失败: %w", err)
+	}
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        target,
+		Host:       target.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+	}
+
+	// 复制请求头，添加额外请求头并执行请求转换；逐跳头部不会复制，握手需要的 Connection 和 Upgrade 重新设置
+	req.Header = requestHeader(c, rule, vars)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", string(c.Request.Header.Peek("Upgrade")))
+	if rule.PreserveHost {
+		req.Host = string(c.Host())
+	}
+
+	// 握手阶段受超时限制，隧道建立后不再限制
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("发送握手请求失败: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("读取握手响应失败: %w", err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, reader, resp, nil
+}
+
+// hostWithPort 返回带端口的主机地址
+func hostWithPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// tunnelWebSocket 在客户端和上游之间双向转发数据，任意一端关闭后结束
+func tunnelWebSocket(client net.Conn, upstream net.Conn, upstreamReader io.Reader, stats *logger.WebSocketLog) {
+	clientCounter := &wsFrameCounter{}
+	upstreamCounter := &wsFrameCounter{}
+
+	done := make(chan string, 2)
+	go func() {
+		io.Copy(upstream, io.TeeReader(client, clientCounter))
+		done <- "client"
+	}()
+	go func() {
+		io.Copy(client, io.TeeReader(upstreamReader, upstreamCounter))
+		done <- "upstream"
+	}()
+
+	// 一端关闭后关闭两端连接，让另一个方向的转发结束
+	stats.ClosedBy = <-done
+	client.Close()
+	upstream.Close()
+	<-done
+
+	stats.CloseTime = time.Now()
+	stats.ClientFrames = clientCounter.frames
+	stats.ClientBytes = clientCounter.bytes
+	stats.UpstreamFrames = upstreamCounter.frames
+	stats.UpstreamBytes = upstreamCounter.bytes
+}
+
+// wsFrameCounter 解析经过的 WebSocket 帧头，统计帧数和字节数
+type wsFrameCounter struct {
+	frames    int64
+	bytes     int64
+	header    []byte // 尚未接收完整的帧头
+	remaining uint64 // 当前帧剩余的负载字节数
+}
+
+// Write 实现 io.Writer
+func (w *wsFrameCounter) Write(p []byte) (int, error) {
+	n := len(p)
+	w.bytes += int64(n)
+
+	for len(p) > 0 {
+		// 跳过负载
+		if w.remaining > 0 {
+			skip := uint64(len(p))
+			if skip > w.remaining {
+				skip = w.remaining
+			}
+			w.remaining -= skip
+			p = p[skip:]
+			continue
+		}
+
+		// 逐字节累积帧头，帧头最长 14 字节
+		w.header = append(w.header, p[0])
+		p = p[1:]
+		if size := wsHeaderSize(w.header); size > 0 && len(w.header) == size {
+			w.frames++
+			w.remaining = wsPayloadLength(w.header)
+			w.header = w.header[:0]
+		}
+	}
+	return n, nil
+}
+
+// wsHeaderSize 根据已接收的帧头字节计算完整帧头长度，字节不足时返回 0
+func wsHeaderSize(header []byte) int {
+	if len(header) < 2 {
+		return 0
+	}
+	size := 2
+	switch header[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if header[1]&0x80 != 0 {
+		size += 4 // 掩码
+	}
+	return size
+}
+
+// wsPayloadLength 从完整帧头中解析负载长度
+func wsPayloadLength(header []byte) uint64 {
+	switch length := header[1] & 0x7f; length {
+	case 126:
+		return uint64(binary.BigEndian.Uint16(header[2:4]))
+	case 127:
+		return binary.BigEndian.Uint64(header[2:10])
+	default:
+		return uint64(length)
+	}
+}
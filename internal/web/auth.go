@@ -11,17 +11,8 @@ import (
 // AdminAuthMiddleware 管理后台认证中间件
 func AdminAuthMiddleware(cfg *config.Config) app.HandlerFunc {
 	return func(ctx context.Context, c *app.RequestContext) {
-		// 获取配置中的 cookie key 和 value
-		cookieKey := cfg.AdminAuth.CookieKey
-		cookieValue := cfg.AdminAuth.CookieValue
-
-		// 如果未配置，使用默认值
-		if cookieKey == "" {
-			cookieKey = "bff_admin_token"
-		}
-		if cookieValue == "" {
-			cookieValue = "change_me_in_production"
-		}
+		// 获取配置中的 cookie key 和 value（未配置时使用默认值）
+		cookieKey, cookieValue := cfg.AdminAuth.Cookie()
 
 		// 获取请求中的 cookie
 		cookieValueFromReq := string(c.Cookie(cookieKey))
@@ -52,17 +43,8 @@ func AdminAuthMiddlewareFromConfig() app.HandlerFunc {
 			return
 		}
 
-		// 获取配置中的 cookie key 和 value
-		cookieKey := cfg.AdminAuth.CookieKey
-		cookieValue := cfg.AdminAuth.CookieValue
-
-		// 如果未配置，使用默认值
-		if cookieKey == "" {
-			cookieKey = "bff_admin_token"
-		}
-		if cookieValue == "" {
-			cookieValue = "change_me_in_production"
-		}
+		// 获取配置中的 cookie key 和 value（未配置时使用默认值）
+		cookieKey, cookieValue := cfg.AdminAuth.Cookie()
 
 		// 获取请求中的 cookie
 		cookieValueFromReq := string(c.Cookie(cookieKey))
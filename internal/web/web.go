@@ -9,10 +9,11 @@ import (
 	"github.com/cloudwego/hertz/pkg/app/server"
 	"github.com/without-php/BFF-proxy/internal/config"
 	"github.com/without-php/BFF-proxy/internal/logger"
+	"github.com/without-php/BFF-proxy/internal/proxy"
 )
 
 // RegisterRoutes 注册 Web UI 路由
-func RegisterRoutes(h *server.Hertz, cfg *config.Config) {
+func RegisterRoutes(h *server.Hertz, cfg *config.Config, p *proxy.ProxyMiddleware) {
 	admin := h.Group("/admin")
 	// 为所有 admin 路由添加认证中间件
 	admin.Use(AdminAuthMiddlewareFromConfig())
@@ -34,6 +35,16 @@ func RegisterRoutes(h *server.Hertz, cfg *config.Config) {
 			api.POST("/config", updateConfig)
 			// 获取日志
 			api.GET("/logs", getLogs)
+			// 获取上游目标状态
+			api.GET("/upstreams", getUpstreams(p))
+			// 运行时摘除/恢复上游目标
+			api.POST("/upstreams/drain", drainUpstream(p))
+			// 获取上游健康状态
+			api.GET("/health", getHealth(p))
+			// 获取熔断器状态
+			api.GET("/breakers", getBreakers(p))
+			// 获取上游连接池状态
+			api.GET("/transports", getTransports(p))
 		}
 	}
 }
@@ -61,8 +72,10 @@ func updateConfig(ctx context.Context, c *app.RequestContext) {
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]string{
-		"message": "配置已更新",
+	// 保存成功后提示不会生效的规则
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "配置已更新",
+		"warnings": cfg.Proxy.ShadowedRules(),
 	})
 }
 
@@ -84,3 +97,57 @@ func getLogs(ctx context.Context, c *app.RequestContext) {
 
 	c.JSON(http.StatusOK, logs)
 }
+
+// getUpstreams 获取上游目标状态
+func getUpstreams(p *proxy.ProxyMiddleware) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		c.JSON(http.StatusOK, p.UpstreamStatus())
+	}
+}
+
+// getHealth 获取上游健康状态
+func getHealth(p *proxy.ProxyMiddleware) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		c.JSON(http.StatusOK, p.HealthStatus())
+	}
+}
+
+// getBreakers 获取熔断器状态
+func getBreakers(p *proxy.ProxyMiddleware) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		c.JSON(http.StatusOK, p.BreakerStatus())
+	}
+}
+
+// getTransports 获取上游连接池状态
+func getTransports(p *proxy.ProxyMiddleware) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		c.JSON(http.StatusOK, p.TransportStatus())
+	}
+}
+
+// drainUpstream 运行时摘除/恢复上游目标
+func drainUpstream(p *proxy.ProxyMiddleware) app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		var req struct {
+			URL   string `json:"url"`
+			Drain bool   `json:"drain"`
+		}
+		if err := c.BindJSON(&req); err != nil || req.URL == "" {
+			c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "无效的请求参数，需要提供 url 和 drain",
+			})
+			return
+		}
+
+		p.SetUpstreamDrained(req.URL, req.Drain)
+
+		message := "上游目标已恢复"
+		if req.Drain {
+			message = "上游目标已摘除"
+		}
+		c.JSON(http.StatusOK, map[string]string{
+			"message": message,
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/cloudwego/hertz/pkg/app/server"
 	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"github.com/without-php/BFF-proxy/internal/config"
+	"github.com/without-php/BFF-proxy/internal/listener"
 	"github.com/without-php/BFF-proxy/internal/logger"
 	"github.com/without-php/BFF-proxy/internal/proxy"
 	"github.com/without-php/BFF-proxy/internal/web"
@@ -29,22 +30,44 @@ func main() {
 	// 启动配置热加载
 	go config.WatchConfig("config.yaml", func() {
 		hlog.Info("配置已重新加载")
+		warnShadowedRules()
 	})
+	warnShadowedRules()
 
 	s, _ := sonic.MarshalString(cfg)
 	hlog.Info("cfg: %s", s)
 
-	// 创建 Hertz 服务器
-	h := server.Default(
-		server.WithHostPorts(fmt.Sprintf(":%d", cfg.Server.Port)),
-	)
-
-	// 注册代理中间件
+	// 创建代理中间件，所有监听端口共享
 	proxyMiddleware := proxy.NewProxyMiddleware(cfg)
-	h.Use(proxyMiddleware.Handle)
 
-	// 注册 Web UI 路由
-	web.RegisterRoutes(h, cfg)
+	// 创建 Hertz 服务器
+	h := newServer(cfg.Server.Port, cfg, proxyMiddleware)
+
+	// 额外的监听端口：HTTP 端口使用新的 Hertz 服务器，HTTPS 端口终止 TLS 后转发到主端口，
+	// h2c 端口同时接收 HTTP/1.1 和不加密的 HTTP/2；HTTPS 和 h2c 端口上的 gRPC 请求直接转发到上游
+	var extraServers []*server.Hertz
+	var listeners []*listener.Listener
+	for _, lc := range cfg.Server.Listeners {
+		switch {
+		case lc.TLS != nil:
+			l, err := listener.NewTLSListener(lc, cfg.Server.Port, proxyMiddleware.GRPCHandler())
+			if err != nil {
+				hlog.Fatalf("创建 HTTPS 监听失败: %v", err)
+			}
+			listeners = append(listeners, l)
+			l.Start()
+			hlog.Info("Web UI 访问地址: https://localhost:" + fmt.Sprintf("%d", lc.Port) + "/admin")
+		case lc.H2C:
+			l := listener.NewH2CListener(lc, cfg.Server.Port, proxyMiddleware.GRPCHandler())
+			listeners = append(listeners, l)
+			l.Start()
+		default:
+			extra := newServer(lc.Port, cfg, proxyMiddleware)
+			extraServers = append(extraServers, extra)
+			go extra.Spin()
+			hlog.Infof("HTTP 监听启动在端口 %d", lc.Port)
+		}
+	}
 
 	hlog.Infof("BFF Proxy 服务启动在端口 %d", cfg.Server.Port)
 	hlog.Info("Web UI 访问地址: http://localhost:" + fmt.Sprintf("%d", cfg.Server.Port) + "/admin")
@@ -56,6 +79,16 @@ func main() {
 	go func() {
 		<-quit
 		hlog.Info("正在关闭服务器...")
+		for _, l := range listeners {
+			if err := l.Shutdown(context.Background()); err != nil {
+				hlog.Errorf("监听关闭失败: %v", err)
+			}
+		}
+		for _, extra := range extraServers {
+			if err := extra.Shutdown(context.Background()); err != nil {
+				hlog.Errorf("服务器关闭失败: %v", err)
+			}
+		}
 		if err := h.Shutdown(context.Background()); err != nil {
 			hlog.Errorf("服务器关闭失败: %v", err)
 		}
@@ -66,3 +99,28 @@ func main() {
 	// 启动服务器
 	h.Spin()
 }
+
+// newServer 创建监听指定端口的 Hertz 服务器，注册代理中间件和 Web UI 路由
+func newServer(port int, cfg *config.Config, proxyMiddleware *proxy.ProxyMiddleware) *server.Hertz {
+	// 请求体以流的形式读取，避免大文件上传占满内存
+	h := server.Default(
+		server.WithHostPorts(fmt.Sprintf(":%d", port)),
+		server.WithStreamBody(true),
+		server.WithDisablePreParseMultipartForm(true),
+	)
+
+	// 注册代理中间件
+	h.Use(proxyMiddleware.Handle)
+
+	// 注册 Web UI 路由
+	web.RegisterRoutes(h, cfg, proxyMiddleware)
+
+	return h
+}
+
+// warnShadowedRules 在日志中提示不会生效的规则
+func warnShadowedRules() {
+	for _, warning := range config.GetConfig().Proxy.ShadowedRules() {
+		hlog.Warn(warning)
+	}
+}